@@ -4,13 +4,17 @@ import (
 	"GoRedis/config"
 	databaseface "GoRedis/interface/database"
 	"GoRedis/lib/logger"
+	"GoRedis/lib/sync/atomic"
 	"GoRedis/lib/utils"
 	"GoRedis/resp/connection"
 	"GoRedis/resp/parser"
 	"GoRedis/resp/reply"
+	"bytes"
 	"io"
 	"os"
+	"path/filepath"
 	"strconv"
+	"time"
 )
 
 // CmdLine 命令行
@@ -20,10 +24,23 @@ const (
 	aofQueueSize = 1 << 16
 )
 
+// 刷盘策略
+const (
+	// 每条指令写入之后都fsync
+	FsyncAlways = "always"
+	// 每秒fsync一次
+	FsyncEverySec = "everysec"
+	// 由操作系统决定什么时候刷盘
+	FsyncNo = "no"
+)
+
 // 将指令和数据库编号封装起来
 type payload struct {
-	cmdLine CmdLine
-	dbIndex int
+	// 依次写入的指令，MULTI/EXEC 包围的一组指令在同一个payload中，中间不会插入其他指令
+	cmdLines []CmdLine
+	dbIndex  int
+	// 不为空时表示刷盘请求，前面的指令都写入文件并fsync之后返回结果
+	synced chan error
 }
 
 // AofHandler 从通道接收消息并写入 AOF 文件
@@ -33,60 +50,214 @@ type AofHandler struct {
 	aofFile     *os.File
 	aofFilename string
 	currentDB   int
+	// 落盘协程退出时关闭
+	aofFinished chan struct{}
+	// 最后一次写文件是否出错
+	lastWriteErr atomic.Boolean
+	// 写文件出错的次数
+	writeErrors atomic.Int64
+	// 有写入之后还没有fsync
+	dirty bool
+	// 加载的文件以没有 EXEC 的 MULTI 结尾
+	unfinishedMulti bool
 }
 
 func NewAofHandler(database databaseface.Database) (*AofHandler, error) {
 	handler := &AofHandler{}
 	// 从配置文件中读取文件名
-	handler.aofFilename = config.Properties.AppendFilename
+	handler.aofFilename = config.Properties().AppendFilename
 	handler.database = database
 	// 加载aof文件
 	handler.LoadAof()
-	aofFile, err := os.OpenFile(handler.aofFilename, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err := handler.start(); err != nil {
+		return nil, err
+	}
+	// 结束文件末尾没有完成的事务，之后追加的指令在重放时不会被当作事务的一部分
+	if handler.unfinishedMulti {
+		handler.aofChan <- &payload{
+			cmdLines: []CmdLine{utils.ToCmdLine("discard")},
+			dbIndex:  handler.currentDB,
+		}
+	}
+	return handler, nil
+}
+
+// NewAofHandlerFromDump 用 dump 输出的指令生成新的AOF文件替换原有的文件，然后开始追加指令
+// 用于运行时开启AOF，dump 需要输出当前数据集的全部内容，执行期间数据不能被修改
+// dump 返回最后选择的数据库，之后的指令从这个数据库开始
+func NewAofHandlerFromDump(database databaseface.Database, dump func(w io.Writer) (int, error)) (*AofHandler, error) {
+	handler := &AofHandler{}
+	handler.aofFilename = config.Properties().AppendFilename
+	handler.database = database
+	tmp, err := os.CreateTemp(filepath.Dir(handler.aofFilename), filepath.Base(handler.aofFilename)+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	currentDB, err := dump(tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), handler.aofFilename)
+	}
 	if err != nil {
 		return nil, err
 	}
+	handler.currentDB = currentDB
+	if err := handler.start(); err != nil {
+		return nil, err
+	}
+	return handler, nil
+}
+
+// 打开AOF文件并开始落盘
+func (handler *AofHandler) start() error {
+	aofFile, err := os.OpenFile(handler.aofFilename, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
 	handler.aofFile = aofFile
 	// 初始化通道
 	handler.aofChan = make(chan *payload, aofQueueSize)
+	handler.aofFinished = make(chan struct{})
 	// 开一个协程用于aof文件的落盘
 	go func() {
 		handler.handlerAof()
 	}()
-	return handler, nil
+	return nil
 }
 
 // AddAof 追加Aof文件，然后塞到channel中
 func (handler *AofHandler) AddAof(dbIndex int, cmd CmdLine) {
-	if config.Properties.AppendOnly && handler.aofChan != nil {
+	if handler.aofChan != nil {
+		handler.aofChan <- &payload{
+			cmdLines: []CmdLine{cmd},
+			dbIndex:  dbIndex,
+		}
+	}
+}
+
+// AddAofMulti 将一组指令包在 MULTI/EXEC 中写入Aof文件，重放时作为事务原子执行
+// 写到一半时宕机，文件末尾没有 EXEC 的指令在重放时不会执行
+func (handler *AofHandler) AddAofMulti(dbIndex int, cmds []CmdLine) {
+	if handler.aofChan != nil {
+		cmdLines := make([]CmdLine, 0, len(cmds)+2)
+		cmdLines = append(cmdLines, utils.ToCmdLine("multi"))
+		cmdLines = append(cmdLines, cmds...)
+		cmdLines = append(cmdLines, utils.ToCmdLine("exec"))
 		handler.aofChan <- &payload{
-			cmdLine: cmd,
-			dbIndex: dbIndex,
+			cmdLines: cmdLines,
+			dbIndex:  dbIndex,
 		}
 	}
 }
 
-// handlerAof aof文件落盘
+// handlerAof aof文件落盘，按照 appendfsync 的策略fsync
 func (handler *AofHandler) handlerAof() {
-	handler.currentDB = 0
-	for p := range handler.aofChan {
-		// 需要切换数据库
-		if p.dbIndex != handler.currentDB {
-			data := reply.MakeMultiBulkReply(utils.ToCmdLine("select", strconv.Itoa(p.dbIndex))).ToBytes()
-			_, err := handler.aofFile.Write(data)
-			if err != nil {
-				logger.Error(err)
+	defer close(handler.aofFinished)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case p, ok := <-handler.aofChan:
+			if !ok {
+				return
+			}
+			// 刷盘请求
+			if p.synced != nil {
+				handler.dirty = false
+				p.synced <- handler.aofFile.Sync()
 				continue
 			}
-			handler.currentDB = p.dbIndex
+			handler.write(p)
+			if config.Properties().AppendFsync == FsyncAlways {
+				handler.fsync()
+			}
+		case <-ticker.C:
+			if config.Properties().AppendFsync == FsyncEverySec {
+				handler.fsync()
+			}
 		}
-		data := reply.MakeMultiBulkReply(p.cmdLine).ToBytes()
+	}
+}
+
+// 将一条指令写入文件，需要时先切换数据库
+func (handler *AofHandler) write(p *payload) {
+	// 需要切换数据库
+	if p.dbIndex != handler.currentDB {
+		data := reply.MakeMultiBulkReply(utils.ToCmdLine("select", strconv.Itoa(p.dbIndex))).ToBytes()
 		_, err := handler.aofFile.Write(data)
+		handler.lastWriteErr.Set(err != nil)
 		if err != nil {
+			handler.writeErrors.Add(1)
 			logger.Error(err)
-			continue
+			return
 		}
+		handler.currentDB = p.dbIndex
+	}
+	var buf bytes.Buffer
+	for _, cmdLine := range p.cmdLines {
+		buf.Write(reply.MakeMultiBulkReply(cmdLine).ToBytes())
+	}
+	_, err := handler.aofFile.Write(buf.Bytes())
+	handler.lastWriteErr.Set(err != nil)
+	if err != nil {
+		handler.writeErrors.Add(1)
+		logger.Error(err)
+		return
+	}
+	handler.dirty = true
+}
+
+// 有写入时fsync
+func (handler *AofHandler) fsync() {
+	if !handler.dirty {
+		return
+	}
+	handler.dirty = false
+	if err := handler.aofFile.Sync(); err != nil {
+		logger.Error("fsync the AOF file: " + err.Error())
+	}
+}
+
+// PendingLen 返回通道中等待写入文件的指令数量
+func (handler *AofHandler) PendingLen() int {
+	return len(handler.aofChan)
+}
+
+// LastWriteOK 返回最后一次写文件是否成功
+func (handler *AofHandler) LastWriteOK() bool {
+	return !handler.lastWriteErr.Get()
+}
+
+// WriteErrors 返回写文件出错的次数
+func (handler *AofHandler) WriteErrors() int64 {
+	return handler.writeErrors.Get()
+}
+
+// Sync 等待通道中的指令全部写入文件，然后fsync
+func (handler *AofHandler) Sync() error {
+	synced := make(chan error, 1)
+	handler.aofChan <- &payload{
+		synced: synced,
 	}
+	return <-synced
+}
+
+// Close 写完通道中剩余的指令，fsync之后关闭文件
+// 关闭之后不能再调用AddAof
+func (handler *AofHandler) Close() error {
+	close(handler.aofChan)
+	<-handler.aofFinished
+	if err := handler.aofFile.Sync(); err != nil {
+		_ = handler.aofFile.Close()
+		return err
+	}
+	return handler.aofFile.Close()
 }
 
 // LoadAof 加载Aof文件
@@ -101,6 +272,8 @@ func (handler *AofHandler) LoadAof() {
 	ch := parser.ParseStream(file)
 	// 创建一个伪客户端，然后把伪客户端传参给Exec函数，目的是获取dbIndex字段，其它字段其实是没有用的
 	fackConn := &connection.Connection{}
+	// 设置了密码时伪客户端也需要通过认证
+	fackConn.SetAuthenticated(true)
 	for p := range ch {
 		if p.Err != nil {
 			if p.Err == io.EOF {
@@ -124,4 +297,10 @@ func (handler *AofHandler) LoadAof() {
 			logger.Error(rep)
 		}
 	}
+	// 写入脚本的效果时宕机，文件末尾的事务没有 EXEC，其中的指令不执行
+	if fackConn.InMultiState() {
+		handler.unfinishedMulti = true
+		logger.Warn("the AOF file ends with an unfinished MULTI block, " +
+			strconv.Itoa(len(fackConn.GetQueuedCmdLine())) + " commands were discarded")
+	}
 }
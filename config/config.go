@@ -1,13 +1,9 @@
 package config
 
 import (
-	"GoRedis/lib/logger"
-	"bufio"
-	"io"
-	"os"
-	"reflect"
-	"strconv"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 )
 
 type ServerProperties struct {
@@ -15,98 +11,154 @@ type ServerProperties struct {
 	Port           int    `cfg:"port"`
 	AppendOnly     bool   `cfg:"appendOnly"`
 	AppendFilename string `cfg:"appendFilename"`
-	MaxClients     int    `cfg:"maxclients "`
-	RequirePass    string `cfg:"requirepass"`
-	Databases      int    `cfg:"databases"`
+	// AOF文件的刷盘策略 always、everysec、no
+	AppendFsync string `cfg:"appendfsync"`
+	MaxClients  int    `cfg:"maxclients"`
+	// 客户端需要通过 AUTH 或者 HELLO AUTH 认证，为空时不需要认证
+	RequirePass string `cfg:"requirepass"`
+	Databases   int    `cfg:"databases"`
+	// 键空间通知的事件类型，比如 KEA
+	NotifyKeyspaceEvents string `cfg:"notify-keyspace-events"`
+	// 单个参数的最大字节数
+	ProtoMaxBulkLen int `cfg:"proto-max-bulk-len"`
+	// 一条命令的最大参数个数
+	ProtoMaxMultiBulkLen int `cfg:"proto-max-multibulk-len"`
+	// 一条命令占用的最大字节数
+	ClientQueryBufferLimit int `cfg:"client-query-buffer-limit"`
+	// 客户端输出缓冲区的限制，格式为 <class> <hard limit> <soft limit> <soft seconds> ...
+	ClientOutputBufferLimit string `cfg:"client-output-buffer-limit"`
+	// 客户端空闲多少秒后断开，0表示不断开
+	Timeout int `cfg:"timeout"`
+	// TCP keepalive 的间隔秒数，0表示不开启
+	TcpKeepalive int `cfg:"tcp-keepalive"`
+	// TLS监听的端口，0表示不开启
+	TlsPort int `cfg:"tls-port"`
+	// 服务端证书和私钥
+	TlsCertFile string `cfg:"tls-cert-file"`
+	TlsKeyFile  string `cfg:"tls-key-file"`
+	// 验证客户端证书使用的CA
+	TlsCaCertFile string `cfg:"tls-ca-cert-file"`
+	// 是否验证客户端证书 yes、no、optional
+	TlsAuthClients string `cfg:"tls-auth-clients"`
+	// Unix socket 的路径，为空表示不监听
+	UnixSocket string `cfg:"unixsocket"`
+	// Unix socket 文件的权限，八进制，比如 700
+	UnixSocketPerm string `cfg:"unixsocketperm"`
+	// 执行时间超过多少微秒的命令记录到慢查询日志，负数表示不记录
+	SlowlogLogSlowerThan int `cfg:"slowlog-log-slower-than"`
+	// 慢查询日志最多保存多少条
+	SlowlogMaxLen int `cfg:"slowlog-max-len"`
+	// 提供 Prometheus 指标的HTTP端口，0表示不开启
+	MetricsPort int `cfg:"metrics-port"`
+	// 最多使用的内存，超过之后拒绝可能增加内存的命令，0表示不限制
+	MaxMemory int `cfg:"maxmemory"`
+	// 日志级别 debug、verbose、notice、warning
+	LogLevel string `cfg:"loglevel"`
+	// 单个日志文件的最大字节数，超过之后轮转，0表示不限制
+	LogMaxSize int `cfg:"log-max-size"`
+	// 保留的旧日志文件数量，0表示全部保留
+	LogMaxFiles int `cfg:"log-max-files"`
+	// 日志格式 text、json
+	LogFormat string `cfg:"log-format"`
+	// 是否同时写入syslog，以及syslog中的程序名和设施
+	SyslogEnabled  bool   `cfg:"syslog-enabled"`
+	SyslogIdent    string `cfg:"syslog-ident"`
+	SyslogFacility string `cfg:"syslog-facility"`
 
 	Peers []string `cfg:"peers"`
 	Self  string   `cfg:"self"`
 }
 
-var Properties *ServerProperties
+// 当前的配置，修改配置时整体替换，其他协程总是读到完整的配置
+var properties atomic.Value
+
+// 启动时使用的配置文件的绝对路径，没有使用配置文件时为空
+var configFile string
+
+// Properties 返回当前的配置，返回的配置只能读取，运行时修改配置使用 Set
+func Properties() *ServerProperties {
+	return properties.Load().(*ServerProperties)
+}
+
+// SetProperties 替换当前的配置
+func SetProperties(p *ServerProperties) {
+	properties.Store(p)
+}
+
+// ConfigFile 返回启动时使用的配置文件
+func ConfigFile() string {
+	return configFile
+}
 
 func init() {
 	// 默认配置
-	Properties = &ServerProperties{
-		Bind:       "127.0.0.1",
-		Port:       63791,
-		AppendOnly: false,
-	}
+	SetProperties(DefaultProperties())
 }
 
-// 解析配置文件
-func parse(src io.Reader) *ServerProperties {
-	config := &ServerProperties{}
-
-	// 读取配置文件
-	// 储存每项配置对应的参数
-	rawMap := make(map[string]string)
-	scanner := bufio.NewScanner(src)
+// 默认的客户端数量上限、keepalive 间隔、慢查询日志和AOF刷盘配置，和Redis一致
+const (
+	DefaultBind                 = "0.0.0.0"
+	DefaultPort                 = 63791
+	DefaultMaxClients           = 10000
+	DefaultTcpKeepalive         = 300
+	DefaultSlowlogLogSlowerThan = 10000
+	DefaultSlowlogMaxLen        = 128
+	DefaultAppendFsync          = "everysec"
+	DefaultAppendFilename       = "appendonly.aof"
+	DefaultDatabases            = 16
+	DefaultLogLevel             = "notice"
+	DefaultLogMaxSize           = 128 * 1024 * 1024
+	DefaultLogMaxFiles          = 10
+	DefaultLogFormat            = "text"
+	DefaultSyslogIdent          = "goredis"
+	DefaultSyslogFacility       = "local0"
+	// 和 connection.GetOutputBufferLimits 的格式一致，CONFIG GET 返回所有类型的限制
+	DefaultClientOutputBufferLimit = "normal 0 0 0 replica 268435456 67108864 60 pubsub 33554432 8388608 60"
+)
 
-	// 逐行读取
-	for scanner.Scan() {
-		line := scanner.Text()
-		if len(line) > 0 && line[0] == '#' {
-			continue
-		}
-		pivot := strings.IndexAny(line, " ")
-		// 将配置信息存入map
-		if pivot > 0 && pivot < len(line)-1 {
-			// 取key
-			key := line[0:pivot]
-			// 取value
-			// 删除value句尾的""字符
-			value := strings.Trim(line[pivot+1:], "")
-			rawMap[strings.ToLower(key)] = value
-		}
-	}
-	if err := scanner.Err(); err != nil {
-		logger.Fatal(err)
+// DefaultProperties 返回配置文件中没有给出的配置项的默认值
+func DefaultProperties() *ServerProperties {
+	return &ServerProperties{
+		Bind:                    DefaultBind,
+		Port:                    DefaultPort,
+		AppendFsync:             DefaultAppendFsync,
+		AppendFilename:          DefaultAppendFilename,
+		Databases:               DefaultDatabases,
+		MaxClients:              DefaultMaxClients,
+		TcpKeepalive:            DefaultTcpKeepalive,
+		SlowlogLogSlowerThan:    DefaultSlowlogLogSlowerThan,
+		SlowlogMaxLen:           DefaultSlowlogMaxLen,
+		LogLevel:                DefaultLogLevel,
+		LogMaxSize:              DefaultLogMaxSize,
+		LogMaxFiles:             DefaultLogMaxFiles,
+		LogFormat:               DefaultLogFormat,
+		SyslogIdent:             DefaultSyslogIdent,
+		SyslogFacility:          DefaultSyslogFacility,
+		ClientOutputBufferLimit: DefaultClientOutputBufferLimit,
 	}
+}
 
-	// 将配置信息映射到config结构体
-	t := reflect.TypeOf(config)
-	v := reflect.ValueOf(config)
-	// 获取config结构体的成员数量
-	n := t.Elem().NumField()
-	for i := 0; i < n; i++ {
-		field := t.Elem().Field(i)
-		fieldVal := v.Elem().Field(i)
-		key, ok := field.Tag.Lookup("cfg")
-		if !ok {
-			key = field.Name
+// Setup 解析配置文件和命令行中的配置，命令行中的配置覆盖配置文件
+// filename 为空时只使用默认配置和命令行中的配置
+func Setup(filename string, overrides string) error {
+	p := DefaultProperties()
+	parser := makeParser(p)
+	if filename != "" {
+		path, err := filepath.Abs(filename)
+		if err != nil {
+			return err
 		}
-		value, ok := rawMap[strings.ToLower(key)]
-		if ok {
-			// 填充配置信息
-			switch field.Type.Kind() {
-			case reflect.String:
-				fieldVal.SetString(value)
-			case reflect.Int:
-				intValue, err := strconv.ParseInt(value, 10, 64)
-				if err == nil {
-					fieldVal.SetInt(intValue)
-				}
-			case reflect.Bool:
-				boolValue := "yes" == value
-				fieldVal.SetBool(boolValue)
-			case reflect.Slice:
-				if field.Type.Elem().Kind() == reflect.String {
-					slice := strings.Split(value, ",")
-					fieldVal.Set(reflect.ValueOf(slice))
-				}
-			}
+		if err := parser.parseFile(path); err != nil {
+			return err
 		}
+		configFile = path
 	}
-	return config
-}
-
-// SetupConfig 打开配置文件并解析
-func SetupConfig(configFilename string) {
-	file, err := os.Open(configFilename)
-	if err != nil {
-		panic(err)
+	if overrides != "" {
+		if err := parser.parse(strings.NewReader(overrides), "command line"); err != nil {
+			return err
+		}
 	}
-	defer file.Close()
-	Properties = parse(file)
+	cmdlineOverrides = overrides
+	SetProperties(p)
+	return nil
 }
@@ -0,0 +1,350 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+/*
+ * 解析配置文件
+ * 每行是一条指令，指令名不区分大小写，参数之间用空白分隔，参数可以用单引号或双引号包围
+ * 双引号中支持 \n、\r、\t、\b、\a、\\、\" 和 \xHH 转义，单引号中只支持 \'
+ * include 指令引入其他配置文件，相对路径相对于当前配置文件所在的目录
+ * 重复出现的指令以最后一次为准，client-output-buffer-limit 等多参数指令和 peers 会累加
+ */
+
+// include 的最大嵌套深度
+const maxIncludeDepth = 16
+
+// ParseError 配置文件中有错误的行
+type ParseError struct {
+	// 配置文件的路径，命令行中的配置为 "command line"
+	File string
+	// 从1开始的行号
+	Line int
+	// 出错的行
+	Text string
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s:%d: '%s': %s", e.File, e.Line, e.Text, e.Msg)
+}
+
+// 将配置写入 ServerProperties，保存多次调用 parse 之间需要共享的状态
+type parser struct {
+	p *ServerProperties
+	// 已经出现过的累加型指令，第一次出现时覆盖默认值
+	seen map[string]bool
+	// 正在解析的配置文件，用于检测循环 include
+	files []string
+}
+
+func makeParser(p *ServerProperties) *parser {
+	return &parser{
+		p:    p,
+		seen: make(map[string]bool),
+	}
+}
+
+// 解析配置文件，path 需要是绝对路径
+func (ps *parser) parseFile(path string) error {
+	for _, f := range ps.files {
+		if f == path {
+			return errors.New("config file " + path + " is included recursively")
+		}
+	}
+	if len(ps.files) >= maxIncludeDepth {
+		return errors.New("too many nested includes in config file " + path)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	ps.files = append(ps.files, path)
+	defer func() {
+		ps.files = ps.files[:len(ps.files)-1]
+	}()
+	return ps.parse(file, path)
+}
+
+// 逐行解析配置
+func (ps *parser) parse(src io.Reader, name string) error {
+	scanner := bufio.NewScanner(src)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		lineErr := func(msg string) error {
+			return &ParseError{File: name, Line: lineNum, Text: line, Msg: msg}
+		}
+		args, err := SplitArgs(line)
+		if err != nil {
+			return lineErr(err.Error())
+		}
+		directive := strings.ToLower(args[0])
+		if directive == "include" {
+			if len(args) != 2 {
+				return lineErr("wrong number of arguments")
+			}
+			path := args[1]
+			if !filepath.IsAbs(path) && len(ps.files) > 0 {
+				path = filepath.Join(filepath.Dir(ps.files[len(ps.files)-1]), path)
+			}
+			if err := ps.parseFile(path); err != nil {
+				var parseErr *ParseError
+				if errors.As(err, &parseErr) {
+					return err
+				}
+				return lineErr(err.Error())
+			}
+			continue
+		}
+		if err := ps.apply(directive, args[1:]); err != nil {
+			return lineErr(err.Error())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.New("reading " + name + ": " + err.Error())
+	}
+	return nil
+}
+
+// 将一条指令写入配置
+func (ps *parser) apply(name string, args []string) error {
+	f, ok := lookupParam(name)
+	if !ok {
+		return errors.New("Bad directive or wrong number of arguments")
+	}
+	if len(args) == 0 {
+		return errors.New("wrong number of arguments")
+	}
+	spec := lookupSpec(name)
+	v := reflect.ValueOf(ps.p).Elem().Field(f.index)
+	first := !ps.seen[name]
+	ps.seen[name] = true
+	switch {
+	case v.Kind() == reflect.Slice:
+		// 用逗号或空白分隔的多个值
+		values := make([]string, 0)
+		if !first {
+			values = append(values, v.Interface().([]string)...)
+		}
+		for _, arg := range args {
+			for _, s := range strings.Split(arg, ",") {
+				if s != "" {
+					values = append(values, s)
+				}
+			}
+		}
+		v.Set(reflect.ValueOf(values))
+		return nil
+	case spec.multiArg:
+		value := strings.Join(args, " ")
+		if spec.validate != nil {
+			if err := spec.validate(value); err != nil {
+				return err
+			}
+		}
+		if !first && v.String() != "" {
+			value = v.String() + " " + value
+		}
+		v.SetString(value)
+		return nil
+	}
+	if len(args) != 1 {
+		return errors.New("wrong number of arguments")
+	}
+	return setField(v, spec, args[0])
+}
+
+// SplitArgs 按照Redis配置文件的规则把一行拆分成参数，支持引号和转义
+func SplitArgs(line string) ([]string, error) {
+	args := make([]string, 0)
+	i := 0
+	for {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		if i >= len(line) {
+			return args, nil
+		}
+		var current []byte
+		inDouble, inSingle, done := false, false, false
+		for !done {
+			if inDouble {
+				if i >= len(line) {
+					return nil, errors.New("unbalanced quotes in configuration line")
+				}
+				c := line[i]
+				if c == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHexDigit(line[i+2]) && isHexDigit(line[i+3]) {
+					current = append(current, hexValue(line[i+2])*16+hexValue(line[i+3]))
+					i += 3
+				} else if c == '\\' && i+1 < len(line) {
+					i++
+					switch line[i] {
+					case 'n':
+						current = append(current, '\n')
+					case 'r':
+						current = append(current, '\r')
+					case 't':
+						current = append(current, '\t')
+					case 'b':
+						current = append(current, '\b')
+					case 'a':
+						current = append(current, '\a')
+					default:
+						current = append(current, line[i])
+					}
+				} else if c == '"' {
+					// 右引号之后必须是空白或者行尾
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, errors.New("unbalanced quotes in configuration line")
+					}
+					done = true
+				} else {
+					current = append(current, c)
+				}
+			} else if inSingle {
+				if i >= len(line) {
+					return nil, errors.New("unbalanced quotes in configuration line")
+				}
+				c := line[i]
+				if c == '\\' && i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					current = append(current, '\'')
+				} else if c == '\'' {
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, errors.New("unbalanced quotes in configuration line")
+					}
+					done = true
+				} else {
+					current = append(current, c)
+				}
+			} else {
+				if i >= len(line) {
+					break
+				}
+				switch c := line[i]; {
+				case isSpace(c):
+					done = true
+				case c == '"':
+					inDouble = true
+				case c == '\'':
+					inSingle = true
+				default:
+					current = append(current, c)
+				}
+			}
+			if i < len(line) {
+				i++
+			}
+		}
+		args = append(args, string(current))
+	}
+}
+
+// QuoteArg 在需要时给参数加上双引号，使 SplitArgs 能够还原
+func QuoteArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\r\n\"'\\") && isPrintable(arg) {
+		return arg
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(arg); i++ {
+		c := arg[i]
+		switch c {
+		case '\\':
+			b.WriteString("\\\\")
+		case '"':
+			b.WriteString("\\\"")
+		case '\n':
+			b.WriteString("\\n")
+		case '\r':
+			b.WriteString("\\r")
+		case '\t':
+			b.WriteString("\\t")
+		case '\a':
+			b.WriteString("\\a")
+		case '\b':
+			b.WriteString("\\b")
+		default:
+			if c < 0x20 || c >= 0x7f {
+				fmt.Fprintf(&b, "\\x%02x", c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\v' || c == '\f'
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func hexValue(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
+
+func isPrintable(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] >= 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseArgs 解析命令行参数，第一个参数不以 -- 开头时作为配置文件的路径
+// 之后的 --name value 转换成配置文件格式的指令，返回的 overrides 可以直接交给 Setup
+func ParseArgs(args []string) (filename string, overrides string, err error) {
+	if len(args) > 0 && !strings.HasPrefix(args[0], "--") {
+		filename = args[0]
+		args = args[1:]
+	}
+	var b strings.Builder
+	for i, arg := range args {
+		if strings.HasPrefix(arg, "--") {
+			name := arg[2:]
+			if name == "" {
+				return "", "", errors.New("invalid option '--'")
+			}
+			if i > 0 {
+				b.WriteByte('\n')
+			}
+			b.WriteString(name)
+			continue
+		}
+		if i == 0 {
+			return "", "", errors.New("unexpected argument '" + arg + "', options should start with '--'")
+		}
+		b.WriteByte(' ')
+		b.WriteString(QuoteArg(arg))
+	}
+	if b.Len() > 0 {
+		b.WriteByte('\n')
+	}
+	return filename, b.String(), nil
+}
@@ -0,0 +1,302 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line string
+		args []string
+	}{
+		{"", []string{}},
+		{"port 6379", []string{"port", "6379"}},
+		{"  save\t900   1  ", []string{"save", "900", "1"}},
+		{`requirepass "with space"`, []string{"requirepass", "with space"}},
+		{`requirepass 'single quoted'`, []string{"requirepass", "single quoted"}},
+		{`requirepass ""`, []string{"requirepass", ""}},
+		{`x "a\nb\tc\\d\"e"`, []string{"x", "a\nb\tc\\d\"e"}},
+		{`x "\x41\x62\x00"`, []string{"x", "Ab\x00"}},
+		{`x "\xZZ"`, []string{"x", "xZZ"}},
+		{`x 'it\'s'`, []string{"x", "it's"}},
+		{`x 'no \n escape'`, []string{"x", `no \n escape`}},
+		{`x a"b"`, []string{"x", "ab"}},
+	}
+	for _, tt := range tests {
+		args, err := SplitArgs(tt.line)
+		if err != nil {
+			t.Errorf("SplitArgs(%q): unexpected error %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("SplitArgs(%q) = %q, want %q", tt.line, args, tt.args)
+		}
+	}
+}
+
+func TestSplitArgsUnbalancedQuotes(t *testing.T) {
+	lines := []string{
+		`requirepass "open`,
+		`requirepass 'open`,
+		`requirepass "closed"trailing`,
+		`requirepass 'closed'trailing`,
+		`x "\"`,
+	}
+	for _, line := range lines {
+		if _, err := SplitArgs(line); err == nil {
+			t.Errorf("SplitArgs(%q): expected unbalanced quotes error", line)
+		}
+	}
+}
+
+func TestQuoteArgRoundTrip(t *testing.T) {
+	values := []string{
+		"plain",
+		"",
+		"with space",
+		`quote"double`,
+		"quote'single",
+		`back\slash`,
+		"new\nline\r\ttab",
+		"\a\b",
+		"\x00\x01\x7f\xff",
+		"中文",
+	}
+	for _, value := range values {
+		quoted := QuoteArg(value)
+		args, err := SplitArgs("x " + quoted)
+		if err != nil {
+			t.Errorf("QuoteArg(%q) = %s: %v", value, quoted, err)
+			continue
+		}
+		if len(args) != 2 || args[1] != value {
+			t.Errorf("QuoteArg(%q) = %s, parsed back as %q", value, quoted, args)
+		}
+	}
+	if QuoteArg("plain") != "plain" {
+		t.Errorf("QuoteArg(plain) = %s, want no quotes", QuoteArg("plain"))
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		args      []string
+		filename  string
+		overrides string
+	}{
+		{nil, "", ""},
+		{[]string{"redis.conf"}, "redis.conf", ""},
+		{[]string{"redis.conf", "--port", "7000"}, "redis.conf", "port 7000\n"},
+		{[]string{"--port", "7000", "--appendonly", "yes"}, "", "port 7000\nappendonly yes\n"},
+		{[]string{"--save", "900", "1", "--requirepass", "a b"}, "", "save 900 1\nrequirepass \"a b\"\n"},
+		{[]string{"--daemonize"}, "", "daemonize\n"},
+	}
+	for _, tt := range tests {
+		filename, overrides, err := ParseArgs(tt.args)
+		if err != nil {
+			t.Errorf("ParseArgs(%q): unexpected error %v", tt.args, err)
+			continue
+		}
+		if filename != tt.filename || overrides != tt.overrides {
+			t.Errorf("ParseArgs(%q) = %q, %q, want %q, %q", tt.args, filename, overrides, tt.filename, tt.overrides)
+		}
+	}
+	for _, args := range [][]string{{"--"}, {"redis.conf", "7000"}} {
+		if _, _, err := ParseArgs(args); err == nil {
+			t.Errorf("ParseArgs(%q): expected error", args)
+		}
+	}
+}
+
+func TestParseMemory(t *testing.T) {
+	tests := []struct {
+		value string
+		n     int64
+	}{
+		{"0", 0},
+		{"100", 100},
+		{"1k", 1000},
+		{"1kb", 1024},
+		{"32MB", 32 * 1024 * 1024},
+		{"2g", 2000 * 1000 * 1000},
+		{"8gb", 8 * 1024 * 1024 * 1024},
+		{"8589934591gb", 8589934591 * 1024 * 1024 * 1024},
+	}
+	for _, tt := range tests {
+		n, err := ParseMemory(tt.value)
+		if err != nil || n != tt.n {
+			t.Errorf("ParseMemory(%q) = %d, %v, want %d", tt.value, n, err, tt.n)
+		}
+	}
+	for _, value := range []string{"", "-1", "abc", "1tb", "17179869184gb", "9223372036854775807k"} {
+		if n, err := ParseMemory(value); err == nil {
+			t.Errorf("ParseMemory(%q) = %d, expected error", value, n)
+		}
+	}
+}
+
+func writeConfig(t *testing.T, dir string, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseFile(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "extra.conf", "maxclients 100\nclient-output-buffer-limit pubsub 1mb 1mb 0\n")
+	path := writeConfig(t, dir, "redis.conf", strings.Join([]string{
+		"# comment",
+		"port 7000",
+		`requirepass "a b"`,
+		"maxmemory 1gb",
+		"client-output-buffer-limit normal 0 0 0",
+		"include extra.conf",
+		"maxclients 200",
+	}, "\n"))
+
+	p := DefaultProperties()
+	if err := makeParser(p).parseFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if p.Port != 7000 || p.RequirePass != "a b" || p.MaxMemory != 1024*1024*1024 {
+		t.Errorf("unexpected properties: port %d, requirepass %q, maxmemory %d", p.Port, p.RequirePass, p.MaxMemory)
+	}
+	// 重复的指令以最后一次为准，包括 include 之后的指令
+	if p.MaxClients != 200 {
+		t.Errorf("maxclients = %d, want 200", p.MaxClients)
+	}
+	// 多参数指令第一次出现时覆盖默认值，之后累加
+	if want := "normal 0 0 0 pubsub 1mb 1mb 0"; p.ClientOutputBufferLimit != want {
+		t.Errorf("client-output-buffer-limit = %q, want %q", p.ClientOutputBufferLimit, want)
+	}
+	if p.AppendFilename != DefaultAppendFilename {
+		t.Errorf("appendfilename = %q, want default", p.AppendFilename)
+	}
+}
+
+func TestParseFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "bad.conf", "port 7000\nport abc\n")
+	tests := []struct {
+		content string
+		file    string
+		line    int
+	}{
+		{"port 7000\nno-such-directive 1\n", "main.conf", 2},
+		{"\n\nport 70000\n", "main.conf", 3},
+		{`requirepass "open`, "main.conf", 1},
+		{"maxmemory 17179869184gb\n", "main.conf", 1},
+		{"appendfsync sometimes\n", "main.conf", 1},
+		{"include bad.conf\n", "bad.conf", 2},
+		{"include missing.conf\n", "main.conf", 1},
+	}
+	for _, tt := range tests {
+		path := writeConfig(t, dir, "main.conf", tt.content)
+		err := makeParser(DefaultProperties()).parseFile(path)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("%q: expected ParseError, got %v", tt.content, err)
+			continue
+		}
+		if filepath.Base(parseErr.File) != tt.file || parseErr.Line != tt.line {
+			t.Errorf("%q: error at %s:%d, want %s:%d", tt.content, parseErr.File, parseErr.Line, tt.file, tt.line)
+		}
+	}
+}
+
+func TestIncludeCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "a.conf", "port 7000\ninclude b.conf\n")
+	writeConfig(t, dir, "b.conf", "include a.conf\n")
+	self := writeConfig(t, dir, "self.conf", "include self.conf\n")
+
+	for _, path := range []string{filepath.Join(dir, "a.conf"), self} {
+		err := makeParser(DefaultProperties()).parseFile(path)
+		if err == nil || !strings.Contains(err.Error(), "included recursively") {
+			t.Errorf("%s: expected include cycle error, got %v", filepath.Base(path), err)
+		}
+	}
+
+	// 同一个文件可以被不同的地方重复引入，只要不形成循环
+	common := writeConfig(t, dir, "common.conf", "maxclients 50\n")
+	path := writeConfig(t, dir, "twice.conf", "include common.conf\ninclude "+common+"\n")
+	p := DefaultProperties()
+	if err := makeParser(p).parseFile(path); err != nil {
+		t.Errorf("including a file twice: %v", err)
+	}
+	if p.MaxClients != 50 {
+		t.Errorf("maxclients = %d, want 50", p.MaxClients)
+	}
+}
+
+func TestIncludeDepth(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i <= maxIncludeDepth; i++ {
+		content := "port 7000\n"
+		if i < maxIncludeDepth {
+			content = "include " + filepath.Join(dir, "level"+string(rune('a'+i+1))+".conf") + "\n"
+		}
+		writeConfig(t, dir, "level"+string(rune('a'+i))+".conf", content)
+	}
+	err := makeParser(DefaultProperties()).parseFile(filepath.Join(dir, "levela.conf"))
+	if err == nil || !strings.Contains(err.Error(), "too many nested includes") {
+		t.Errorf("expected include depth error, got %v", err)
+	}
+}
+
+func TestParseFileValidator(t *testing.T) {
+	saved := make(map[string]paramSpec)
+	for _, name := range []string{"notify-keyspace-events", "client-output-buffer-limit"} {
+		saved[name] = paramSpecs[name]
+	}
+	defer func() {
+		for name, spec := range saved {
+			paramSpecs[name] = spec
+		}
+	}()
+	RegisterValidator("notify-keyspace-events", func(value string) error {
+		if strings.Trim(value, "KEA") != "" {
+			return errors.New("invalid event class")
+		}
+		return nil
+	})
+	RegisterValidator("client-output-buffer-limit", func(value string) error {
+		if len(strings.Fields(value))%4 != 0 {
+			return errors.New("wrong number of arguments")
+		}
+		return nil
+	})
+
+	dir := t.TempDir()
+	tests := []struct {
+		content string
+		line    int
+	}{
+		{"port 7000\nnotify-keyspace-events KEx\n", 2},
+		{"client-output-buffer-limit normal 0 0 0\nclient-output-buffer-limit pubsub 1mb\n", 2},
+	}
+	for _, tt := range tests {
+		path := writeConfig(t, dir, "main.conf", tt.content)
+		err := makeParser(DefaultProperties()).parseFile(path)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) || parseErr.Line != tt.line {
+			t.Errorf("%q: expected ParseError at line %d, got %v", tt.content, tt.line, err)
+		}
+	}
+	path := writeConfig(t, dir, "main.conf", "notify-keyspace-events KEA\n")
+	if err := makeParser(DefaultProperties()).parseFile(path); err != nil {
+		t.Errorf("valid notify-keyspace-events: %v", err)
+	}
+	// CONFIG SET 同样检查格式
+	if err := Set([]string{"notify-keyspace-events", "KEx"}); err == nil || !strings.Contains(err.Error(), "invalid event class") {
+		t.Errorf("CONFIG SET with an invalid value: %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+)
+
+// 启动时命令行中的配置，重新加载配置文件时同样覆盖配置文件
+var cmdlineOverrides string
+
+// ReloadResult 重新加载配置文件的结果
+type ReloadResult struct {
+	// 已经生效的配置项
+	Applied []string
+	// 配置文件中修改了但需要重启才能生效的配置项
+	RestartRequired []string
+}
+
+// Reload 重新解析启动时使用的配置文件和命令行中的配置
+// 可以在运行时修改的配置项通过 Set 立即生效，其他修改过的配置项保持原来的值，在结果中列出
+func Reload() (*ReloadResult, error) {
+	if configFile == "" {
+		return nil, errors.New("the server is running without a config file")
+	}
+	p := DefaultProperties()
+	parser := makeParser(p)
+	if err := parser.parseFile(configFile); err != nil {
+		return nil, err
+	}
+	if cmdlineOverrides != "" {
+		if err := parser.parse(strings.NewReader(cmdlineOverrides), "command line"); err != nil {
+			return nil, err
+		}
+	}
+
+	current := reflect.ValueOf(Properties()).Elem()
+	loaded := reflect.ValueOf(p).Elem()
+	result := &ReloadResult{}
+	params := make([]string, 0)
+	for _, f := range paramFields {
+		value := formatValue(loaded.Field(f.index))
+		if value == formatValue(current.Field(f.index)) {
+			continue
+		}
+		if lookupSpec(f.name).mutable {
+			params = append(params, f.name, value)
+			result.Applied = append(result.Applied, f.name)
+		} else {
+			result.RestartRequired = append(result.RestartRequired, f.name)
+		}
+	}
+	if len(params) > 0 {
+		if err := Set(params); err != nil {
+			result.Applied = nil
+			return result, err
+		}
+	}
+	return result, nil
+}
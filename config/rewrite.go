@@ -0,0 +1,115 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// CONFIG REWRITE 追加的配置项之前的注释
+const rewriteSignature = "# Generated by CONFIG REWRITE"
+
+// Rewrite 将当前的配置写回启动时使用的配置文件
+// 已经存在的配置项原地修改，重复出现的只保留第一个，注释和不认识的行保持不变
+// 文件中没有但和默认值不同的配置项追加到文件末尾
+func Rewrite() error {
+	if configFile == "" {
+		return errors.New("ERR The server is running without a config file")
+	}
+	content, err := os.ReadFile(configFile)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.New("ERR Rewriting config file: " + err.Error())
+	}
+
+	current := reflect.ValueOf(Properties()).Elem()
+	defaults := reflect.ValueOf(DefaultProperties()).Elem()
+	written := make(map[string]bool)
+	var buf bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		// 之前生成的注释会在末尾重新生成
+		if trimmed == rewriteSignature {
+			continue
+		}
+		if trimmed == "" || trimmed[0] == '#' {
+			buf.WriteString(line + "\n")
+			continue
+		}
+		name := strings.ToLower(strings.Fields(trimmed)[0])
+		f, ok := lookupParam(name)
+		if !ok {
+			buf.WriteString(line + "\n")
+			continue
+		}
+		if written[f.name] {
+			continue
+		}
+		written[f.name] = true
+		buf.WriteString(formatDirective(f, current.Field(f.index)) + "\n")
+	}
+
+	signed := false
+	for _, f := range paramFields {
+		if written[f.name] {
+			continue
+		}
+		if formatValue(current.Field(f.index)) == formatValue(defaults.Field(f.index)) {
+			continue
+		}
+		if !signed {
+			buf.WriteString("\n" + rewriteSignature + "\n")
+			signed = true
+		}
+		buf.WriteString(formatDirective(f, current.Field(f.index)) + "\n")
+	}
+
+	if err := writeFileAtomic(configFile, buf.Bytes()); err != nil {
+		return errors.New("ERR Rewriting config file: " + err.Error())
+	}
+	return nil
+}
+
+// 生成配置文件中的一行，参数在需要时加上引号
+// 多参数的配置项中每个参数都是单独的单词，原样输出
+func formatDirective(f paramField, v reflect.Value) string {
+	value := formatValue(v)
+	if !lookupSpec(f.name).multiArg || value == "" {
+		value = QuoteArg(value)
+	}
+	return f.name + " " + value
+}
+
+// 先写入同一目录下的临时文件，fsync之后再替换原文件，避免写到一半时文件损坏
+func writeFileAtomic(filename string, data []byte) error {
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(filename); err == nil {
+		perm = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, filename)
+}
@@ -0,0 +1,276 @@
+package config
+
+import (
+	"GoRedis/lib/wildcard"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+ * 运行时读取和修改配置，供 CONFIG GET/SET 使用
+ * 配置项的名称是 cfg 标签的小写形式，只有 paramSpecs 中标记为 mutable 的配置项可以在运行时修改
+ */
+
+// 配置项的取值范围，解析配置文件和 CONFIG SET 时检查
+type paramSpec struct {
+	// 是否可以在运行时修改
+	mutable bool
+	// 整数的取值范围
+	min int64
+	max int64
+	// 字符串只能取其中的值，为空表示不限制
+	enum []string
+	// 整数可以使用 kb、mb 等内存单位
+	memory bool
+	// 配置文件中可以有多个参数，重复出现时追加到之前的值后面
+	multiArg bool
+	// 检查字符串的格式，由解析配置的包通过 RegisterValidator 注册
+	validate func(value string) error
+}
+
+// 没有在 paramSpecs 中的整数配置项不限制范围
+var defaultSpec = paramSpec{min: math.MinInt64, max: math.MaxInt64}
+
+var paramSpecs = map[string]paramSpec{
+	"port":                       {min: 0, max: 65535},
+	"tls-port":                   {min: 0, max: 65535},
+	"metrics-port":               {min: 0, max: 65535},
+	"databases":                  {min: 1, max: math.MaxInt32},
+	"tcp-keepalive":              {min: 0, max: math.MaxInt32},
+	"tls-auth-clients":           {enum: []string{"yes", "no", "optional"}},
+	"log-max-size":               {min: 0, max: math.MaxInt64, memory: true},
+	"log-max-files":              {min: 0, max: math.MaxInt32},
+	"log-format":                 {enum: []string{"text", "json"}},
+	"syslog-facility":            {enum: []string{"user", "local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7"}},
+	"loglevel":                   {mutable: true, enum: []string{"debug", "verbose", "notice", "warning"}},
+	"appendonly":                 {mutable: true},
+	"appendfsync":                {mutable: true, enum: []string{"always", "everysec", "no"}},
+	"maxclients":                 {mutable: true, min: 1, max: math.MaxInt32},
+	"timeout":                    {mutable: true, min: 0, max: math.MaxInt32},
+	"slowlog-log-slower-than":    {mutable: true, min: -1, max: math.MaxInt64},
+	"slowlog-max-len":            {mutable: true, min: 0, max: math.MaxInt32},
+	"maxmemory":                  {mutable: true, min: 0, max: math.MaxInt64, memory: true},
+	"requirepass":                {mutable: true},
+	"notify-keyspace-events":     {mutable: true},
+	"client-output-buffer-limit": {mutable: true, multiArg: true},
+	"proto-max-bulk-len":         {mutable: true, min: 1024 * 1024, max: math.MaxInt64, memory: true},
+	"proto-max-multibulk-len":    {mutable: true, min: 1, max: math.MaxInt32},
+	"client-query-buffer-limit":  {mutable: true, min: 1024 * 1024, max: math.MaxInt64, memory: true},
+}
+
+// 返回配置项的取值范围
+func lookupSpec(name string) paramSpec {
+	if spec, ok := paramSpecs[name]; ok {
+		return spec
+	}
+	return defaultSpec
+}
+
+// RegisterValidator 注册字符串配置项的格式检查，解析配置文件和 CONFIG SET 时调用
+// 多参数的配置项在配置文件中逐行检查，只能在包的 init 中调用
+func RegisterValidator(name string, fn func(value string) error) {
+	name = strings.ToLower(name)
+	spec := lookupSpec(name)
+	spec.validate = fn
+	paramSpecs[name] = spec
+}
+
+// ApplyFunc 在配置项修改之后使配置生效，返回错误时修改会被撤销
+// 可以修改 p 中对应的配置项，比如只修改了部分内容时保存合并之后的完整值
+type ApplyFunc func(p *ServerProperties) error
+
+var (
+	// 保证同一时间只有一个 CONFIG SET 在修改配置
+	setMu      sync.Mutex
+	applyFuncs = make(map[string]ApplyFunc)
+)
+
+// RegisterApplyFunc 注册配置项修改之后需要执行的操作
+func RegisterApplyFunc(name string, fn ApplyFunc) {
+	setMu.Lock()
+	defer setMu.Unlock()
+	applyFuncs[strings.ToLower(name)] = fn
+}
+
+// 配置项的名称和结构体中的位置
+type paramField struct {
+	name  string
+	index int
+}
+
+// 所有配置项，按名称排序
+var paramFields = func() []paramField {
+	fields := make([]paramField, 0)
+	t := reflect.TypeOf(ServerProperties{})
+	for i := 0; i < t.NumField(); i++ {
+		key, ok := t.Field(i).Tag.Lookup("cfg")
+		if !ok {
+			key = t.Field(i).Name
+		}
+		fields = append(fields, paramField{name: strings.ToLower(key), index: i})
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].name < fields[j].name
+	})
+	return fields
+}()
+
+func lookupParam(name string) (paramField, bool) {
+	name = strings.ToLower(name)
+	for _, f := range paramFields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	return paramField{}, false
+}
+
+// 将配置项的值转换成字符串，布尔值使用 yes 和 no
+func formatValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return "yes"
+		}
+		return "no"
+	case reflect.Int:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Slice:
+		return strings.Join(v.Interface().([]string), ",")
+	}
+	return v.String()
+}
+
+// Get 返回名称和 pattern 匹配的配置项，按名称排序，名称和值交替排列
+func Get(pattern string) []string {
+	p := reflect.ValueOf(Properties()).Elem()
+	matcher := wildcard.CompilePattern(strings.ToLower(pattern))
+	result := make([]string, 0)
+	for _, f := range paramFields {
+		if matcher.IsMatch(f.name) {
+			result = append(result, f.name, formatValue(p.Field(f.index)))
+		}
+	}
+	return result
+}
+
+// 检查配置项的值并写入结构体
+func setField(v reflect.Value, spec paramSpec, value string) error {
+	switch v.Kind() {
+	case reflect.Bool:
+		switch strings.ToLower(value) {
+		case "yes":
+			v.SetBool(true)
+		case "no":
+			v.SetBool(false)
+		default:
+			return errors.New("argument must be 'yes' or 'no'")
+		}
+	case reflect.Int:
+		var n int64
+		var err error
+		if spec.memory {
+			n, err = ParseMemory(value)
+			if err != nil {
+				return errors.New("argument must be a memory value")
+			}
+		} else {
+			n, err = strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return errors.New("argument couldn't be parsed into an integer")
+			}
+		}
+		if n < spec.min || n > spec.max {
+			return fmt.Errorf("argument must be between %d and %d inclusive", spec.min, spec.max)
+		}
+		v.SetInt(n)
+	case reflect.String:
+		if len(spec.enum) > 0 {
+			value = strings.ToLower(value)
+			found := false
+			for _, e := range spec.enum {
+				if e == value {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return errors.New("argument(s) must be one of the following: " + strings.Join(spec.enum, ", "))
+			}
+		}
+		if spec.validate != nil {
+			if err := spec.validate(value); err != nil {
+				return err
+			}
+		}
+		v.SetString(value)
+	default:
+		return errors.New("can't set immutable config")
+	}
+	return nil
+}
+
+// Set 同时修改多个配置项，params 中名称和值交替排列
+// 所有值都合法时才会修改，修改之后依次执行注册的 ApplyFunc，有一个失败时恢复原来的配置
+// 返回的错误信息和Redis一致，可以直接作为错误回复
+func Set(params []string) error {
+	setMu.Lock()
+	defer setMu.Unlock()
+
+	old := Properties()
+	updated := *old
+	v := reflect.ValueOf(&updated).Elem()
+	names := make([]string, 0, len(params)/2)
+	seen := make(map[string]bool)
+	for i := 0; i+1 < len(params); i += 2 {
+		name := strings.ToLower(params[i])
+		f, ok := lookupParam(name)
+		if !ok {
+			return errors.New("ERR Unknown option or number of arguments for CONFIG SET - '" + name + "'")
+		}
+		if seen[name] {
+			return setError(name, "duplicate parameter")
+		}
+		seen[name] = true
+		spec := lookupSpec(name)
+		if !spec.mutable {
+			return setError(name, "can't set immutable config")
+		}
+		if err := setField(v.Field(f.index), spec, params[i+1]); err != nil {
+			return setError(name, err.Error())
+		}
+		names = append(names, name)
+	}
+
+	SetProperties(&updated)
+	for i, name := range names {
+		fn := applyFuncs[name]
+		if fn == nil {
+			continue
+		}
+		if err := fn(&updated); err != nil {
+			// 恢复原来的配置，已经生效的配置项重新应用原来的值
+			SetProperties(old)
+			for _, applied := range names[:i] {
+				if fn := applyFuncs[applied]; fn != nil {
+					_ = fn(old)
+				}
+			}
+			return setError(name, err.Error())
+		}
+	}
+	// 保存 ApplyFunc 修改之后的值
+	final := updated
+	SetProperties(&final)
+	return nil
+}
+
+func setError(name string, msg string) error {
+	return errors.New("ERR CONFIG SET failed (possibly related to argument '" + name + "') - " + msg)
+}
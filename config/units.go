@@ -0,0 +1,44 @@
+package config
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// 内存单位，和Redis一致，k/m/g 是1000的倍数，kb/mb/gb 是1024的倍数
+var memoryUnits = []struct {
+	suffix string
+	factor int64
+}{
+	{"kb", 1024},
+	{"mb", 1024 * 1024},
+	{"gb", 1024 * 1024 * 1024},
+	{"k", 1000},
+	{"m", 1000 * 1000},
+	{"g", 1000 * 1000 * 1000},
+	{"b", 1},
+}
+
+// ParseMemory 解析带单位的内存大小，比如 32mb、1gb，单位不区分大小写
+func ParseMemory(value string) (int64, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	factor := int64(1)
+	for _, unit := range memoryUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			factor = unit.factor
+			value = strings.TrimSuffix(value, unit.suffix)
+			break
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, errors.New("invalid memory value: " + value)
+	}
+	// 乘以单位之后溢出的值不能当作0或者负数使用
+	if n > math.MaxInt64/factor {
+		return 0, errors.New("memory value out of range: " + value)
+	}
+	return n * factor, nil
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"GoRedis/interface/resp"
+	"GoRedis/resp/reply"
+	"crypto/subtle"
+)
+
+/*
+ * AUTH
+ * 设置了 requirepass 之后，客户端需要先通过 AUTH 或 HELLO AUTH 认证才能执行其他命令
+ * 只有一个 default 用户，没有ACL
+ */
+
+// 没有认证时也可以执行的命令，QUIT 由协议层处理
+var noAuthCmds = map[string]bool{
+	"auth":  true,
+	"hello": true,
+}
+
+// 返回当前的密码，空字符串表示不需要认证
+func (Sdb *StandaloneDatabase) password() string {
+	return Sdb.requirePass.Load().(string)
+}
+
+// CheckAuth 检查客户端能否执行命令，需要认证时返回错误回复，可以执行时返回nil
+func (Sdb *StandaloneDatabase) CheckAuth(client resp.Connection, cmdName string) resp.Reply {
+	if noAuthCmds[cmdName] || Sdb.password() == "" || client.IsAuthenticated() {
+		return nil
+	}
+	return reply.MakeErrReply("NOAUTH Authentication required.")
+}
+
+// 检查用户名和密码，没有设置密码时 default 用户使用任意密码都可以通过
+func (Sdb *StandaloneDatabase) checkPassword(username string, password string) bool {
+	if username != "default" {
+		return false
+	}
+	requirePass := Sdb.password()
+	return requirePass == "" || subtle.ConstantTimeCompare([]byte(password), []byte(requirePass)) == 1
+}
+
+// AUTH [username] password
+func (Sdb *StandaloneDatabase) execAuth(client resp.Connection, args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("auth")
+	}
+	if len(args) > 2 {
+		return reply.MakeSyntaxErrReply()
+	}
+	username := "default"
+	password := string(args[len(args)-1])
+	if len(args) == 2 {
+		username = string(args[0])
+	} else if Sdb.password() == "" {
+		return reply.MakeErrReply("ERR AUTH <password> called without any password configured for the default user. " +
+			"Are you sure your configuration is correct?")
+	}
+	if !Sdb.checkPassword(username, password) {
+		return reply.MakeErrReply("WRONGPASS invalid username-password pair or user is disabled.")
+	}
+	client.SetAuthenticated(true)
+	return reply.MakeOkReply()
+}
@@ -0,0 +1,283 @@
+package database
+
+import (
+	"GoRedis/interface/resp"
+	"GoRedis/resp/reply"
+	"strings"
+)
+
+/*
+ * COMMAND 命令
+ * 客户端连接后通过 COMMAND 获取每个命令的参数个数、标志和key的位置
+ * 命令的信息都保存在命令表中
+ */
+
+// COMMAND | COMMAND COUNT | COMMAND INFO [command ...] | COMMAND DOCS [command ...] | COMMAND GETKEYS command [arg ...]
+func execCommandCmd(args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return commandInfoReply(sortedCommandNames())
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "count":
+		if len(args) != 1 {
+			return reply.MakeErrReply("ERR wrong number of arguments for 'command|count' command")
+		}
+		return reply.MakeIntReply(int64(len(cmdTable)))
+	case "info":
+		if len(args) == 1 {
+			return commandInfoReply(sortedCommandNames())
+		}
+		return commandInfoReply(lowerNames(args[1:]))
+	case "docs":
+		if len(args) == 1 {
+			return commandDocsReply(sortedCommandNames())
+		}
+		return commandDocsReply(lowerNames(args[1:]))
+	case "getkeys":
+		if len(args) < 2 {
+			return reply.MakeErrReply("ERR wrong number of arguments for 'command|getkeys' command")
+		}
+		return commandGetKeys(args[1:])
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try COMMAND HELP.")
+}
+
+func lowerNames(args [][]byte) []string {
+	names := make([]string, len(args))
+	for i, arg := range args {
+		names[i] = strings.ToLower(string(arg))
+	}
+	return names
+}
+
+// 每个命令输出 名称、参数个数、标志、第一个key、最后一个key、key的间隔、ACL分类
+// 不存在的命令输出空值
+func commandInfoReply(names []string) resp.Reply {
+	result := make([]resp.Reply, len(names))
+	for i, name := range names {
+		cmd, ok := cmdTable[name]
+		if !ok {
+			result[i] = reply.MakeNullBulkReply()
+			continue
+		}
+		result[i] = reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeBulkReply([]byte(name)),
+			reply.MakeIntReply(int64(cmd.arity)),
+			statusSet(cmd.flagNames()),
+			reply.MakeIntReply(int64(cmd.firstKey)),
+			reply.MakeIntReply(int64(cmd.lastKey)),
+			reply.MakeIntReply(int64(cmd.keyStep)),
+			statusSet(cmd.aclCategories()),
+		})
+	}
+	return reply.MakeMultiRawReply(result)
+}
+
+func statusSet(values []string) resp.Reply {
+	members := make([]resp.Reply, len(values))
+	for i, value := range values {
+		members[i] = reply.MakeStatusReply(value)
+	}
+	return reply.MakeSetReply(members)
+}
+
+// 以 名称 -> 文档 的格式输出，不存在的命令不输出
+func commandDocsReply(names []string) resp.Reply {
+	result := make([]resp.Reply, 0, len(names)*2)
+	for _, name := range names {
+		if _, ok := cmdTable[name]; !ok {
+			continue
+		}
+		doc := commandDocs[name]
+		result = append(result,
+			reply.MakeBulkReply([]byte(name)),
+			reply.MakeMapReply([]resp.Reply{
+				reply.MakeBulkReply([]byte("summary")), reply.MakeBulkReply([]byte(doc.summary)),
+				reply.MakeBulkReply([]byte("group")), reply.MakeBulkReply([]byte(doc.group)),
+			}),
+		)
+	}
+	return reply.MakeMapReply(result)
+}
+
+// 使用命令的 prepare 函数找出参数中的key，按照参数中出现的顺序返回
+func commandGetKeys(cmdLine [][]byte) resp.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := cmdTable[cmdName]
+	if !ok {
+		return reply.MakeErrReply("ERR Invalid command specified")
+	}
+	if !validateArity(cmd.arity, cmdLine) {
+		return reply.MakeErrReply("ERR Invalid number of arguments specified for command")
+	}
+	if cmd.prepare == nil {
+		return reply.MakeErrReply("ERR The command has no key arguments")
+	}
+	write, read := cmd.prepare(cmdLine[1:])
+	counts := make(map[string]int)
+	for _, key := range write {
+		counts[key]++
+	}
+	for _, key := range read {
+		counts[key]++
+	}
+	keys := make([][]byte, 0, len(write)+len(read))
+	for _, arg := range cmdLine[1:] {
+		if counts[string(arg)] > 0 {
+			counts[string(arg)]--
+			keys = append(keys, arg)
+		}
+	}
+	if len(keys) == 0 {
+		return reply.MakeErrReply("ERR The command has no key arguments")
+	}
+	return reply.MakeMultiBulkReply(keys)
+}
+
+func init() {
+	// 由 StandaloneDatabase 执行的命令
+	registerSpecialCommand("auth", -2).
+		attachInfo(flagNoScript|flagLoading|flagStale|flagFast, 0, 0, 0, aclConnection)
+	registerSpecialCommand("hello", -1).
+		attachInfo(flagNoScript|flagLoading|flagStale|flagFast, 0, 0, 0, aclConnection)
+	registerSpecialCommand("info", -1).
+		attachInfo(flagLoading|flagStale, 0, 0, 0, aclDangerous)
+	registerSpecialCommand("slowlog", -2).
+		attachInfo(flagAdmin|flagLoading|flagStale, 0, 0, 0)
+	registerSpecialCommand("latency", -2).
+		attachInfo(flagAdmin|flagNoScript|flagLoading|flagStale, 0, 0, 0)
+	registerSpecialCommand("monitor", 1).
+		attachInfo(flagAdmin|flagNoScript|flagLoading|flagStale, 0, 0, 0)
+	registerSpecialCommand("command", -1).
+		attachInfo(flagLoading|flagStale, 0, 0, 0, aclConnection)
+	registerSpecialCommand("config", -2).
+		attachInfo(flagAdmin|flagNoScript|flagLoading|flagStale, 0, 0, 0)
+	registerSpecialCommand("subscribe", -2).
+		attachInfo(flagPubSub|flagNoScript|flagLoading|flagStale, 0, 0, 0)
+	registerSpecialCommand("unsubscribe", -1).
+		attachInfo(flagPubSub|flagNoScript|flagLoading|flagStale, 0, 0, 0)
+	registerSpecialCommand("psubscribe", -2).
+		attachInfo(flagPubSub|flagNoScript|flagLoading|flagStale, 0, 0, 0)
+	registerSpecialCommand("punsubscribe", -1).
+		attachInfo(flagPubSub|flagNoScript|flagLoading|flagStale, 0, 0, 0)
+	registerSpecialCommand("publish", 3).
+		attachInfo(flagPubSub|flagLoading|flagStale|flagFast, 0, 0, 0)
+	registerSpecialCommand("pubsub", -2).
+		attachInfo(flagPubSub|flagLoading|flagStale, 0, 0, 0)
+	registerSpecialCommand("flushdb", 1).
+		attachInfo(flagWrite, 0, 0, 0, aclKeyspace, aclDangerous)
+	// 由 DB 执行的事务命令
+	registerSpecialCommand("multi", 1).
+		attachInfo(flagNoScript|flagLoading|flagStale|flagFast, 0, 0, 0, aclTransaction)
+	registerSpecialCommand("exec", 1).
+		attachInfo(flagNoScript|flagLoading|flagStale, 0, 0, 0, aclTransaction)
+	registerSpecialCommand("discard", 1).
+		attachInfo(flagNoScript|flagLoading|flagStale|flagFast, 0, 0, 0, aclTransaction)
+	registerSpecialCommand("watch", -2).
+		attachInfo(flagNoScript|flagLoading|flagStale|flagFast, 1, -1, 1, aclTransaction)
+	// 由协议层执行的命令
+	registerSpecialCommand("client", -2).
+		attachInfo(flagAdmin|flagNoScript|flagLoading|flagStale, 0, 0, 0, aclConnection)
+	registerSpecialCommand("quit", -1).
+		attachInfo(flagNoScript|flagLoading|flagStale|flagFast, 0, 0, 0, aclConnection)
+	registerSpecialCommand("shutdown", -1).
+		attachInfo(flagAdmin|flagNoScript|flagLoading|flagStale, 0, 0, 0)
+}
+
+// COMMAND DOCS 输出的文档
+type commandDoc struct {
+	summary string
+	group   string
+}
+
+var commandDocs = map[string]commandDoc{
+	// generic
+	"del":      {"Deletes one or more keys.", "generic"},
+	"exists":   {"Determines whether one or more keys exist.", "generic"},
+	"type":     {"Determines the type of value stored at a key.", "generic"},
+	"rename":   {"Renames a key and overwrites the destination.", "generic"},
+	"renamenx": {"Renames a key only when the target key name doesn't exist.", "generic"},
+	"keys":     {"Returns all key names that match a pattern.", "generic"},
+	"getver":   {"Returns the version of a key used by WATCH.", "generic"},
+	// string
+	"get":    {"Returns the string value of a key.", "string"},
+	"set":    {"Sets the string value of a key.", "string"},
+	"setnx":  {"Set the string value of a key only when the key doesn't exist.", "string"},
+	"getset": {"Returns the previous string value of a key after setting it to a new value.", "string"},
+	"strlen": {"Returns the length of a string value.", "string"},
+	// list
+	"lpush":  {"Prepends one or more elements to a list.", "list"},
+	"lpushx": {"Prepends one or more elements to a list only when the list exists.", "list"},
+	"rpush":  {"Appends one or more elements to a list.", "list"},
+	"rpushx": {"Appends an element to a list only when the list exists.", "list"},
+	"lpop":   {"Returns the first element of a list after removing it.", "list"},
+	"rpop":   {"Returns the last element of a list after removing it.", "list"},
+	"lrem":   {"Removes elements from a list.", "list"},
+	"llen":   {"Returns the length of a list.", "list"},
+	"lindex": {"Returns an element from a list by its index.", "list"},
+	"lset":   {"Sets the value of an element in a list by its index.", "list"},
+	"lrange": {"Returns a range of elements from a list.", "list"},
+	// set
+	"sadd":      {"Adds one or more members to a set.", "set"},
+	"sismember": {"Determines whether a member belongs to a set.", "set"},
+	"srem":      {"Removes one or more members from a set.", "set"},
+	"scard":     {"Returns the number of members in a set.", "set"},
+	"smembers":  {"Returns all members of a set.", "set"},
+	"sinter":    {"Returns the intersect of multiple sets.", "set"},
+	"sunion":    {"Returns the union of multiple sets.", "set"},
+	"sdiff":     {"Returns the difference of multiple sets.", "set"},
+	// sorted set
+	"zadd":             {"Adds one or more members to a sorted set.", "sorted-set"},
+	"zscore":           {"Returns the score of a member in a sorted set.", "sorted-set"},
+	"zrank":            {"Returns the index of a member in a sorted set ordered by ascending scores.", "sorted-set"},
+	"zcount":           {"Returns the count of members in a sorted set that have scores within a range.", "sorted-set"},
+	"zcard":            {"Returns the number of members in a sorted set.", "sorted-set"},
+	"zrange":           {"Returns members in a sorted set within a range of indexes.", "sorted-set"},
+	"zrem":             {"Removes one or more members from a sorted set.", "sorted-set"},
+	"zremrangebyscore": {"Removes members in a sorted set within a range of scores.", "sorted-set"},
+	"zremrangebyrank":  {"Removes members in a sorted set within a range of indexes.", "sorted-set"},
+	// hash
+	"hset":    {"Sets the value of a field in a hash.", "hash"},
+	"hsetnx":  {"Sets the value of a field in a hash only when the field doesn't exist.", "hash"},
+	"hget":    {"Returns the value of a field in a hash.", "hash"},
+	"hexists": {"Determines whether a field exists in a hash.", "hash"},
+	"hdel":    {"Deletes one or more fields from a hash.", "hash"},
+	"hlen":    {"Returns the number of fields in a hash.", "hash"},
+	"hmset":   {"Sets the values of multiple fields.", "hash"},
+	"hmget":   {"Returns the values of multiple fields in a hash.", "hash"},
+	"hkeys":   {"Returns all fields in a hash.", "hash"},
+	"hvals":   {"Returns all values in a hash.", "hash"},
+	"hgetall": {"Returns all fields and values in a hash.", "hash"},
+	// scripting
+	"eval":    {"Executes a server-side Lua script.", "scripting"},
+	"evalsha": {"Executes a server-side Lua script by SHA1 digest.", "scripting"},
+	"script":  {"Manages the server-side Lua script cache.", "scripting"},
+	// pubsub
+	"subscribe":    {"Listens for messages published to channels.", "pubsub"},
+	"unsubscribe":  {"Stops listening to messages posted to channels.", "pubsub"},
+	"psubscribe":   {"Listens for messages published to channels that match one or more patterns.", "pubsub"},
+	"punsubscribe": {"Stops listening to messages published to channels that match one or more patterns.", "pubsub"},
+	"publish":      {"Posts a message to a channel.", "pubsub"},
+	"pubsub":       {"Inspects the state of the Pub/Sub subsystem.", "pubsub"},
+	// transactions
+	"multi":   {"Starts a transaction.", "transactions"},
+	"exec":    {"Executes all commands in a transaction.", "transactions"},
+	"discard": {"Discards a transaction.", "transactions"},
+	"watch":   {"Monitors changes to keys to determine the execution of a transaction.", "transactions"},
+	// connection
+	"ping":   {"Returns the server's liveliness response.", "connection"},
+	"auth":   {"Authenticates the connection.", "connection"},
+	"hello":  {"Handshakes with the Redis server.", "connection"},
+	"client": {"Inspects and manages client connections.", "connection"},
+	"quit":   {"Closes the connection.", "connection"},
+	// server
+	"info":     {"Returns information and statistics about the server.", "server"},
+	"slowlog":  {"Inspects the slow log.", "server"},
+	"latency":  {"Returns the cumulative distribution of latencies of commands.", "server"},
+	"monitor":  {"Listens for all requests received by the server in real-time.", "server"},
+	"command":  {"Returns detailed information about all commands.", "server"},
+	"config":   {"Gets, sets, rewrites and resets the configuration and statistics.", "server"},
+	"flushdb":  {"Removes all keys from the current database.", "server"},
+	"shutdown": {"Flushes the AOF file to disk and shuts down the server.", "server"},
+}
@@ -0,0 +1,234 @@
+package database
+
+import (
+	"GoRedis/interface/resp"
+	"GoRedis/resp/reply"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+ * 命令统计
+ * INFO commandstats 和 LATENCY HISTOGRAM 的数据在 DB 执行命令时记录，INFO errorstats 的数据在返回错误时记录
+ * 所有的计数器都是原子变量，执行命令的协程之间不需要加锁
+ */
+
+// 延迟直方图的桶数量，第i个桶记录延迟不超过 2^i 微秒的调用，最后一个桶记录更慢的调用
+const histogramBuckets = 32
+
+// 一个命令的统计信息
+type commandStats struct {
+	// 调用次数
+	calls int64
+	// 总耗时，单位微秒
+	usec int64
+	// 执行前被拒绝的次数，比如参数个数错误
+	rejectedCalls int64
+	// 执行后返回错误的次数
+	failedCalls int64
+	// 延迟直方图
+	histogram [histogramBuckets]int64
+}
+
+// 记录一次执行
+func (s *commandStats) record(duration time.Duration, result resp.Reply) {
+	usec := duration.Microseconds()
+	atomic.AddInt64(&s.calls, 1)
+	atomic.AddInt64(&s.usec, usec)
+	atomic.AddInt64(&s.histogram[latencyBucket(usec)], 1)
+	if _, ok := result.(reply.ErrorReply); ok {
+		atomic.AddInt64(&s.failedCalls, 1)
+	}
+}
+
+// 记录一次被拒绝的调用
+func (s *commandStats) reject() {
+	atomic.AddInt64(&s.rejectedCalls, 1)
+}
+
+func (s *commandStats) reset() {
+	atomic.StoreInt64(&s.calls, 0)
+	atomic.StoreInt64(&s.usec, 0)
+	atomic.StoreInt64(&s.rejectedCalls, 0)
+	atomic.StoreInt64(&s.failedCalls, 0)
+	for i := range s.histogram {
+		atomic.StoreInt64(&s.histogram[i], 0)
+	}
+}
+
+// 返回延迟所在的桶，即 2^i >= usec 的最小的i
+func latencyBucket(usec int64) int {
+	if usec <= 1 {
+		return 0
+	}
+	i := bits.Len64(uint64(usec - 1))
+	if i >= histogramBuckets {
+		return histogramBuckets - 1
+	}
+	return i
+}
+
+// 按照错误前缀统计的错误回复次数，比如 ERR、WRONGTYPE
+var errorStats sync.Map
+
+// 返回给客户端的错误回复总数
+var totalErrorReplies int64
+
+// 记录返回给客户端的错误，事务中每条命令的错误单独记录
+func recordErrorReply(cmdName string, result resp.Reply) {
+	if cmdName == "exec" {
+		if multi, ok := result.(*reply.MultiRawReply); ok {
+			for _, r := range multi.Replies {
+				recordErrorReply("", r)
+			}
+			return
+		}
+	}
+	if _, ok := result.(reply.ErrorReply); !ok {
+		return
+	}
+	prefix := errorPrefix(result.ToBytes())
+	counter, ok := errorStats.Load(prefix)
+	if !ok {
+		counter, _ = errorStats.LoadOrStore(prefix, new(int64))
+	}
+	atomic.AddInt64(counter.(*int64), 1)
+	atomic.AddInt64(&totalErrorReplies, 1)
+}
+
+// -WRONGTYPE Operation against a key... 的前缀是 WRONGTYPE
+func errorPrefix(b []byte) string {
+	msg := strings.TrimSuffix(strings.TrimPrefix(string(b), "-"), reply.CRLF)
+	if i := strings.IndexByte(msg, ' '); i >= 0 {
+		msg = msg[:i]
+	}
+	return msg
+}
+
+// 清空命令统计和错误统计
+func resetCommandStats() {
+	for _, cmd := range cmdTable {
+		cmd.stats.reset()
+	}
+	errorStats.Range(func(key, value interface{}) bool {
+		errorStats.Delete(key)
+		return true
+	})
+	atomic.StoreInt64(&totalErrorReplies, 0)
+}
+
+// 按照名称排序的命令名
+func sortedCommandNames() []string {
+	names := make([]string, 0, len(cmdTable))
+	for name := range cmdTable {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// cmdstat_set:calls=3,usec=20,usec_per_call=6.67,rejected_calls=0,failed_calls=0
+func (Sdb *StandaloneDatabase) infoCommandStats() []infoField {
+	fields := make([]infoField, 0)
+	for _, name := range sortedCommandNames() {
+		stats := cmdTable[name].stats
+		calls := atomic.LoadInt64(&stats.calls)
+		rejected := atomic.LoadInt64(&stats.rejectedCalls)
+		if calls == 0 && rejected == 0 {
+			continue
+		}
+		usec := atomic.LoadInt64(&stats.usec)
+		perCall := 0.0
+		if calls > 0 {
+			perCall = float64(usec) / float64(calls)
+		}
+		fields = append(fields, infoField{
+			"cmdstat_" + name,
+			"calls=" + strconv.FormatInt(calls, 10) +
+				",usec=" + strconv.FormatInt(usec, 10) +
+				",usec_per_call=" + strconv.FormatFloat(perCall, 'f', 2, 64) +
+				",rejected_calls=" + strconv.FormatInt(rejected, 10) +
+				",failed_calls=" + strconv.FormatInt(atomic.LoadInt64(&stats.failedCalls), 10),
+		})
+	}
+	return fields
+}
+
+// errorstat_ERR:count=5
+func (Sdb *StandaloneDatabase) infoErrorStats() []infoField {
+	fields := make([]infoField, 0)
+	errorStats.Range(func(key, value interface{}) bool {
+		fields = append(fields, infoField{
+			"errorstat_" + key.(string),
+			"count=" + strconv.FormatInt(atomic.LoadInt64(value.(*int64)), 10),
+		})
+		return true
+	})
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].key < fields[j].key
+	})
+	return fields
+}
+
+// LATENCY HISTOGRAM [command ...]
+func execLatency(args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("latency")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	if subCmd != "histogram" {
+		return reply.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try LATENCY HELP.")
+	}
+	var names []string
+	if len(args) == 1 {
+		names = sortedCommandNames()
+	} else {
+		for _, arg := range args[1:] {
+			names = append(names, strings.ToLower(string(arg)))
+		}
+	}
+	result := make([]resp.Reply, 0)
+	seen := make(map[string]bool)
+	for _, name := range names {
+		cmd, ok := cmdTable[name]
+		// 不存在的命令和没有调用过的命令不输出
+		if !ok || seen[name] {
+			continue
+		}
+		seen[name] = true
+		calls := atomic.LoadInt64(&cmd.stats.calls)
+		if calls == 0 {
+			continue
+		}
+		result = append(result,
+			reply.MakeBulkReply([]byte(name)),
+			reply.MakeMapReply([]resp.Reply{
+				reply.MakeBulkReply([]byte("calls")),
+				reply.MakeIntReply(calls),
+				reply.MakeBulkReply([]byte("histogram_usec")),
+				histogramReply(cmd.stats),
+			}),
+		)
+	}
+	return reply.MakeMapReply(result)
+}
+
+// 累计分布，只输出有调用的桶
+func histogramReply(stats *commandStats) resp.Reply {
+	buckets := make([]resp.Reply, 0)
+	var total int64
+	for i := range stats.histogram {
+		count := atomic.LoadInt64(&stats.histogram[i])
+		if count == 0 {
+			continue
+		}
+		total += count
+		buckets = append(buckets, reply.MakeIntReply(int64(1)<<uint(i)), reply.MakeIntReply(total))
+	}
+	return reply.MakeMapReply(buckets)
+}
@@ -15,15 +15,165 @@ type command struct {
 	executor ExecFunc
 	// 参数数量
 	arity int
+	// 调用次数、耗时等统计信息
+	stats *commandStats
+
+	/*
+	 * COMMAND 命令输出的信息
+	 */
+	// 命令的标志
+	flags int
+	// 第一个key和最后一个key的位置以及key之间的间隔，没有key时都为0
+	// 最后一个key为负数时表示从末尾开始计算，-1表示最后一个参数
+	firstKey int
+	lastKey  int
+	keyStep  int
+	// ACL分类，@read、@write、@fast、@slow等根据标志生成
+	categories []string
+}
+
+// 命令的标志
+const (
+	// 会修改数据
+	flagWrite = 1 << iota
+	// 只读取数据
+	flagReadOnly
+	// 可能会占用更多的内存
+	flagDenyOOM
+	// 管理命令
+	flagAdmin
+	// 发布订阅相关的命令
+	flagPubSub
+	// 不能在脚本中执行
+	flagNoScript
+	// 加载数据时可以执行
+	flagLoading
+	// 数据不是最新的时候可以执行
+	flagStale
+	// 时间复杂度是O(1)或O(log(N))
+	flagFast
+	// key的位置不固定，需要解析参数才能确定
+	flagMovableKeys
+)
+
+// 标志的名称，按照输出顺序排列
+var flagNames = []struct {
+	flag int
+	name string
+}{
+	{flagWrite, "write"},
+	{flagReadOnly, "readonly"},
+	{flagDenyOOM, "denyoom"},
+	{flagAdmin, "admin"},
+	{flagPubSub, "pubsub"},
+	{flagNoScript, "noscript"},
+	{flagLoading, "loading"},
+	{flagStale, "stale"},
+	{flagFast, "fast"},
+	{flagMovableKeys, "movablekeys"},
+}
+
+// ACL分类
+const (
+	aclKeyspace    = "@keyspace"
+	aclString      = "@string"
+	aclList        = "@list"
+	aclHash        = "@hash"
+	aclSet         = "@set"
+	aclSortedSet   = "@sortedset"
+	aclConnection  = "@connection"
+	aclTransaction = "@transaction"
+	aclScripting   = "@scripting"
+	aclDangerous   = "@dangerous"
+)
+
+// 不在命令表中但会修改数据的命令
+var extraWriteCmds = map[string]bool{
+	"flushdb": true,
+	"publish": true,
+	"exec":    true,
+}
+
+// IsWriteCommand 判断命令是否会修改数据
+// 命令表中可以回滚的命令都是写命令
+func IsWriteCommand(name string) bool {
+	name = strings.ToLower(name)
+	if extraWriteCmds[name] {
+		return true
+	}
+	cmd, ok := cmdTable[name]
+	return ok && cmd.undo != nil
 }
 
 // RegisterCommand 在map中注册命令
-func RegisterCommand(name string, executor ExecFunc, prepare PreFunc, rollback UndoFunc, arity int) {
+func RegisterCommand(name string, executor ExecFunc, prepare PreFunc, rollback UndoFunc, arity int) *command {
 	name = strings.ToLower(name)
-	cmdTable[name] = &command{
+	cmd := &command{
 		executor: executor,
 		prepare:  prepare,
 		undo:     rollback,
 		arity:    arity,
+		stats:    &commandStats{},
+	}
+	cmdTable[name] = cmd
+	return cmd
+}
+
+// 注册由 StandaloneDatabase 或者协议层执行的命令，命令表中只保存 COMMAND 输出的信息
+func registerSpecialCommand(name string, arity int) *command {
+	return RegisterCommand(name, nil, nil, nil, arity)
+}
+
+// 设置 COMMAND 输出的标志、key的位置和ACL分类
+func (cmd *command) attachInfo(flags int, firstKey int, lastKey int, keyStep int, categories ...string) *command {
+	cmd.flags = flags
+	cmd.firstKey = firstKey
+	cmd.lastKey = lastKey
+	cmd.keyStep = keyStep
+	cmd.categories = categories
+	return cmd
+}
+
+// 查找可以在DB中执行的命令，只有说明信息的命令视为不存在
+func lookupCommand(name string) (*command, bool) {
+	cmd, ok := cmdTable[name]
+	if !ok || cmd.executor == nil {
+		return nil, false
+	}
+	return cmd, true
+}
+
+// 标志的名称
+func (cmd *command) flagNames() []string {
+	names := make([]string, 0)
+	for _, f := range flagNames {
+		if cmd.flags&f.flag != 0 {
+			names = append(names, f.name)
+		}
+	}
+	return names
+}
+
+// 完整的ACL分类，包括根据标志生成的分类
+func (cmd *command) aclCategories() []string {
+	categories := make([]string, 0, len(cmd.categories)+4)
+	if cmd.flags&flagWrite != 0 {
+		categories = append(categories, "@write")
+	}
+	if cmd.flags&flagReadOnly != 0 {
+		categories = append(categories, "@read")
+	}
+	categories = append(categories, cmd.categories...)
+	if cmd.flags&flagAdmin != 0 {
+		categories = append(categories, "@admin", aclDangerous)
+	}
+	if cmd.flags&flagPubSub != 0 {
+		categories = append(categories, "@pubsub")
+	}
+	if cmd.flags&flagFast != 0 {
+		categories = append(categories, "@fast")
+	} else {
+		categories = append(categories, "@slow")
 	}
+	return categories
 }
@@ -0,0 +1,213 @@
+package database
+
+import (
+	"GoRedis/aof"
+	"GoRedis/config"
+	"GoRedis/interface/database"
+	"GoRedis/interface/resp"
+	"GoRedis/lib/logger"
+	"GoRedis/lib/utils"
+	"GoRedis/resp/connection"
+	"GoRedis/resp/reply"
+	"io"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+/*
+ * CONFIG 命令
+ * GET 和 SET 由 config 包实现，修改之后需要立即生效的配置项在这里注册 ApplyFunc
+ */
+
+var configHelp = []string{
+	"CONFIG <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"GET <pattern>",
+	"    Return parameters matching the glob-like <pattern> and their values.",
+	"SET <directive> <value> [<directive> <value> ...]",
+	"    Set the configuration <directive> to <value>.",
+	"RESETSTAT",
+	"    Reset statistics reported by the INFO command.",
+	"REWRITE",
+	"    Rewrite the configuration file.",
+	"HELP",
+	"    Print this help.",
+}
+
+func (Sdb *StandaloneDatabase) execConfig(args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("config")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "get":
+		if len(args) < 2 {
+			return reply.MakeArgNumErrReply("config|get")
+		}
+		// 多个 pattern 匹配到同一个配置项时只返回一次
+		seen := make(map[string]bool)
+		result := make([]resp.Reply, 0)
+		for _, pattern := range args[1:] {
+			params := config.Get(string(pattern))
+			for i := 0; i+1 < len(params); i += 2 {
+				if seen[params[i]] {
+					continue
+				}
+				seen[params[i]] = true
+				result = append(result,
+					reply.MakeBulkReply([]byte(params[i])),
+					reply.MakeBulkReply([]byte(params[i+1])))
+			}
+		}
+		return reply.MakeMapReply(result)
+	case "set":
+		if len(args) < 3 || len(args)%2 == 0 {
+			return reply.MakeArgNumErrReply("config|set")
+		}
+		params := make([]string, len(args)-1)
+		for i, arg := range args[1:] {
+			params[i] = string(arg)
+		}
+		if err := config.Set(params); err != nil {
+			return reply.MakeErrReply(err.Error())
+		}
+		return reply.MakeOkReply()
+	case "resetstat":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("config|resetstat")
+		}
+		resetCommandStats()
+		atomic.StoreUint64(&peakMemory, 0)
+		Sdb.resetStats()
+		return reply.MakeOkReply()
+	case "rewrite":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("config|rewrite")
+		}
+		if err := config.Rewrite(); err != nil {
+			logger.Error("CONFIG REWRITE failed: " + err.Error())
+			return reply.MakeErrReply(err.Error())
+		}
+		logger.Info("CONFIG REWRITE executed with success.")
+		return reply.MakeOkReply()
+	case "help":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("config|help")
+		}
+		lines := make([]resp.Reply, len(configHelp))
+		for i, line := range configHelp {
+			lines[i] = reply.MakeStatusReply(line)
+		}
+		return reply.MakeMultiRawReply(lines)
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + subCmd + "'. Try CONFIG HELP.")
+}
+
+// 注册修改配置之后需要执行的操作
+func (Sdb *StandaloneDatabase) registerApplyFuncs() {
+	config.RegisterApplyFunc("appendonly", func(p *config.ServerProperties) error {
+		if p.AppendOnly {
+			return Sdb.startAof()
+		}
+		if Sdb.aof() != nil {
+			Sdb.stopAof()
+			logger.Info("AOF disabled")
+		}
+		return nil
+	})
+	config.RegisterApplyFunc("notify-keyspace-events", func(p *config.ServerProperties) error {
+		return Sdb.SetKeyspaceEvents(p.NotifyKeyspaceEvents)
+	})
+	config.RegisterApplyFunc("client-output-buffer-limit", func(p *config.ServerProperties) error {
+		if err := connection.SetOutputBufferLimits(p.ClientOutputBufferLimit); err != nil {
+			return err
+		}
+		// 没有给出的类型保持原来的限制，保存所有类型的限制，CONFIG GET 和 REWRITE 不会丢失其他类型
+		p.ClientOutputBufferLimit = connection.GetOutputBufferLimits()
+		return nil
+	})
+	config.RegisterApplyFunc("requirepass", func(p *config.ServerProperties) error {
+		// 已经认证的客户端不受影响
+		Sdb.requirePass.Store(p.RequirePass)
+		return nil
+	})
+	config.RegisterApplyFunc("slowlog-max-len", func(p *config.ServerProperties) error {
+		Sdb.slowlog.trim(p.SlowlogMaxLen)
+		return nil
+	})
+}
+
+// 运行时开启AOF：暂停所有数据库的命令，将当前数据集写入新的AOF文件，然后开始追加之后的命令
+func (Sdb *StandaloneDatabase) startAof() error {
+	if Sdb.aof() != nil {
+		return nil
+	}
+	Sdb.lockAll()
+	defer Sdb.unlockAll()
+	handler, err := aof.NewAofHandlerFromDump(Sdb, Sdb.dumpCommands)
+	if err != nil {
+		logger.Error("can't start AOF: " + err.Error())
+		return err
+	}
+	Sdb.aofHandler.Store(handler)
+	logger.Info("AOF enabled, " + config.Properties().AppendFilename + " rewritten with the current dataset")
+	return nil
+}
+
+// 关闭AOF：不再追加命令，将已经接收的命令写入文件之后关闭文件，运行时关闭和服务器关闭时使用
+func (Sdb *StandaloneDatabase) stopAof() {
+	handler := Sdb.aof()
+	if handler == nil {
+		return
+	}
+	// 正在执行的写命令持有key的锁，等它们追加完成之后再替换
+	Sdb.lockAll()
+	Sdb.aofHandler.Store((*aof.AofHandler)(nil))
+	Sdb.unlockAll()
+	if err := handler.Close(); err != nil {
+		logger.Error("error closing the AOF file: " + err.Error())
+	}
+}
+
+// 将所有数据库的数据转换成命令写入w，返回最后选择的数据库
+func (Sdb *StandaloneDatabase) dumpCommands(w io.Writer) (int, error) {
+	currentDB := 0
+	for _, db := range Sdb.dbSet {
+		if db.data.Len() == 0 {
+			continue
+		}
+		if db.index != currentDB {
+			selectCmd := reply.MakeMultiBulkReply(utils.ToCmdLine("select", strconv.Itoa(db.index)))
+			if _, err := w.Write(selectCmd.ToBytes()); err != nil {
+				return 0, err
+			}
+			currentDB = db.index
+		}
+		var err error
+		db.data.ForEach(func(key string, val interface{}) bool {
+			cmd := aof.EntityToCmd(key, val.(*database.DataEntity))
+			if cmd == nil {
+				return true
+			}
+			_, err = w.Write(cmd.ToBytes())
+			return err == nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return currentDB, nil
+}
+
+// 给所有数据库的所有key加锁
+func (Sdb *StandaloneDatabase) lockAll() {
+	for _, db := range Sdb.dbSet {
+		db.locker.LockAll()
+	}
+}
+
+func (Sdb *StandaloneDatabase) unlockAll() {
+	for i := len(Sdb.dbSet) - 1; i >= 0; i-- {
+		Sdb.dbSet[i].locker.UnLockAll()
+	}
+}
@@ -7,26 +7,59 @@ import (
 	"GoRedis/lib/logger"
 	"GoRedis/pubsub"
 	"GoRedis/resp/reply"
+	"errors"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
+// 订阅模式下允许执行的命令
+var subscribeModeCmds = map[string]bool{
+	"subscribe":    true,
+	"unsubscribe":  true,
+	"psubscribe":   true,
+	"punsubscribe": true,
+	"ping":         true,
+	"quit":         true,
+}
+
 // StandaloneDatabase Redis内核数据库
 // 是一个装有数据库map的切片
 type StandaloneDatabase struct {
 	dbSet []*DB
-	// 处理aof持久化
-	aofHandler *aof.AofHandler
+	// 处理aof持久化，保存 *aof.AofHandler，没有开启AOF时为nil
+	// 运行时可以通过 CONFIG SET appendonly 开启或关闭
+	aofHandler atomic.Value
 	// 处理发布/订阅
 	hub *pubsub.Hub
+	// 键空间通知的事件类型
+	notifyFlags int32
+	// 协议层的统计信息，用于 INFO 命令
+	stats StatsFunc
+	// 清空协议层的统计信息
+	resetStats func()
+	// 慢查询日志
+	slowlog *slowLog
+	// 执行了 MONITOR 的客户端
+	monitors *monitors
+	// requirepass 设置的密码，运行时可以通过 CONFIG SET 修改
+	requirePass atomic.Value
 }
 
 func NewStandaloneDatabase() *StandaloneDatabase {
-	database := &StandaloneDatabase{}
-	if config.Properties.Databases <= 0 {
-		config.Properties.Databases = 16
+	database := &StandaloneDatabase{
+		stats:      func() HandlerStats { return HandlerStats{} },
+		resetStats: func() {},
+		slowlog:    makeSlowLog(),
+		monitors:   makeMonitors(),
+	}
+	database.requirePass.Store(config.Properties().RequirePass)
+	databases := config.Properties().Databases
+	if databases <= 0 {
+		databases = 16
 	}
-	database.dbSet = make([]*DB, config.Properties.Databases)
+	database.dbSet = make([]*DB, databases)
 	database.hub = pubsub.MakeHub()
 	// 初始化所有DB
 	for i := range database.dbSet {
@@ -35,39 +68,116 @@ func NewStandaloneDatabase() *StandaloneDatabase {
 		database.dbSet[i] = db
 	}
 	// 初始化aof持久化
-	if config.Properties.AppendOnly {
+	database.aofHandler.Store((*aof.AofHandler)(nil))
+	for _, db := range database.dbSet {
+		// 防止闭包出现问题
+		sdb := db
+		sdb.addAof = func(line CmdLine) {
+			if handler := database.aof(); handler != nil {
+				handler.AddAof(sdb.index, line)
+			}
+		}
+		sdb.addAofMulti = func(lines []CmdLine) {
+			if handler := database.aof(); handler != nil {
+				handler.AddAofMulti(sdb.index, lines)
+			}
+		}
+	}
+	if config.Properties().AppendOnly {
 		aofHandler, err := aof.NewAofHandler(database)
 		if err != nil {
 			panic(err)
 		}
-		database.aofHandler = aofHandler
-		for _, db := range database.dbSet {
-			// 防止闭包出现问题
-			sdb := db
-			sdb.addAof = func(line CmdLine) {
-				database.aofHandler.AddAof(sdb.index, line)
-			}
+		database.aofHandler.Store(aofHandler)
+	}
+	// 初始化键空间通知，配置在解析时已经检查过
+	if err := database.SetKeyspaceEvents(config.Properties().NotifyKeyspaceEvents); err != nil {
+		panic(err)
+	}
+	for _, db := range database.dbSet {
+		sdb := db
+		sdb.notify = func(class int, event string, key string) {
+			database.notifyKeyspaceEvent(sdb.index, class, event, key)
 		}
 	}
+	database.registerApplyFuncs()
 	return database
 }
 
-// Exec
+// 返回处理AOF持久化的handler，没有开启AOF时返回nil
+func (Sdb *StandaloneDatabase) aof() *aof.AofHandler {
+	return Sdb.aofHandler.Load().(*aof.AofHandler)
+}
+
+// Exec 执行命令，并统计返回给客户端的错误
+func (Sdb *StandaloneDatabase) Exec(client resp.Connection, cmdLine [][]byte) resp.Reply {
+	result := Sdb.exec(client, cmdLine)
+	recordErrorReply(strings.ToLower(string(cmdLine[0])), result)
+	return result
+}
+
 // set k v
 // get k
 // select 2
-func (Sdb *StandaloneDatabase) Exec(client resp.Connection, cmdLine [][]byte) resp.Reply {
+func (Sdb *StandaloneDatabase) exec(client resp.Connection, cmdLine [][]byte) resp.Reply {
+	// 获取第一个命令的名称
+	cmdName := strings.ToLower(string(cmdLine[0]))
 	// 防止突然终止程序
 	defer func() {
 		if err := recover(); err != nil {
-			logger.Error(err)
+			logger.With("addr", client.Addr(), "db", client.GetDBIndex(), "cmd", cmdName).Error(err)
 		}
 	}()
-	// 获取第一个命令的名称
-	cmdName := strings.ToLower(string(cmdLine[0]))
 
-	// 订阅频道
-	if cmdName == "subscribe" {
+	// 设置了密码时，没有认证的客户端只能执行 AUTH 和 HELLO
+	if errReply := Sdb.CheckAuth(client, cmdName); errReply != nil {
+		return errReply
+	}
+	// RESP2的订阅模式下只能执行订阅相关的命令
+	if client.SubsCount() > 0 && client.GetProtocol() == reply.Resp2 {
+		if !subscribeModeCmds[cmdName] {
+			return reply.MakeErrReply("ERR Can't execute '" + cmdName +
+				"': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context")
+		}
+		if cmdName == "ping" {
+			return pubsub.Ping(cmdLine[1:])
+		}
+	}
+	// 监视器只接收其他客户端执行的命令
+	if client.IsMonitor() {
+		return reply.MakeErrReply("ERR Can't execute '" + cmdName +
+			"': only QUIT is allowed in this context")
+	}
+
+	// 监视所有客户端执行的命令
+	if cmdName == "monitor" {
+		return Sdb.monitors.exec(client)
+	}
+	Sdb.monitors.publish(client, cmdLine)
+
+	// 认证
+	if cmdName == "auth" {
+		return Sdb.execAuth(client, cmdLine[1:])
+		// 协商协议版本
+	} else if cmdName == "hello" {
+		return Sdb.execHello(client, cmdLine[1:])
+		// 服务器信息
+	} else if cmdName == "info" {
+		return Sdb.execInfo(cmdLine[1:])
+		// 慢查询日志
+	} else if cmdName == "slowlog" {
+		return Sdb.slowlog.exec(cmdLine[1:])
+		// 命令的延迟直方图
+	} else if cmdName == "latency" {
+		return execLatency(cmdLine[1:])
+		// 命令的参数个数、标志和key的位置
+	} else if cmdName == "command" {
+		return execCommandCmd(cmdLine[1:])
+		// 读取和修改配置
+	} else if cmdName == "config" {
+		return Sdb.execConfig(cmdLine[1:])
+		// 订阅频道
+	} else if cmdName == "subscribe" {
 		if len(cmdLine) < 2 {
 			return reply.MakeArgNumErrReply("subscribe")
 		}
@@ -78,6 +188,18 @@ func (Sdb *StandaloneDatabase) Exec(client resp.Connection, cmdLine [][]byte) re
 		// 退订频道
 	} else if cmdName == "unsubscribe" {
 		return pubsub.UnSubscribe(Sdb.hub, client, cmdLine[1:])
+		// 查看频道和模式的订阅情况
+	} else if cmdName == "pubsub" {
+		return pubsub.PubSub(Sdb.hub, cmdLine[1:])
+		// 订阅模式
+	} else if cmdName == "psubscribe" {
+		if len(cmdLine) < 2 {
+			return reply.MakeArgNumErrReply("psubscribe")
+		}
+		return pubsub.PSubscribe(Sdb.hub, client, cmdLine[1:])
+		// 退订模式
+	} else if cmdName == "punsubscribe" {
+		return pubsub.PUnSubscribe(Sdb.hub, client, cmdLine[1:])
 		// 清除当前数据库
 	} else if cmdName == "flushdb" {
 		if !validateArity(1, cmdLine) {
@@ -92,15 +214,41 @@ func (Sdb *StandaloneDatabase) Exec(client resp.Connection, cmdLine [][]byte) re
 
 	dbIndex := client.GetDBIndex()
 	db := Sdb.dbSet[dbIndex]
-	return db.Exec(client, cmdLine)
+	// 记录执行时间，超过阈值的命令写入慢查询日志
+	start := time.Now()
+	result := db.Exec(client, cmdLine)
+	Sdb.slowlog.record(client, cmdLine, start, time.Since(start))
+	return result
 }
 
+// AfterClientClose 客户端断开后退订它订阅的所有频道和模式，并删除监视器
 func (Sdb *StandaloneDatabase) AfterClientClose(c resp.Connection) {
+	pubsub.UnsubscribeAll(Sdb.hub, c)
+	pubsub.PUnsubscribeAll(Sdb.hub, c)
+	Sdb.monitors.remove(c)
+}
 
+// PrepareShutdown 关闭前将AOF缓冲的指令写入文件并fsync
+// 目前不支持快照，要求生成快照时返回错误
+func (Sdb *StandaloneDatabase) PrepareShutdown(save bool) error {
+	if handler := Sdb.aof(); handler != nil {
+		logger.Info("calling fsync() on the AOF file.")
+		if err := handler.Sync(); err != nil {
+			logger.Error("error syncing the AOF file: " + err.Error())
+			return err
+		}
+	}
+	if save {
+		logger.Error("snapshot persistence is not supported, can't save the dataset on shutdown")
+		return errors.New("snapshot persistence is not supported")
+	}
+	return nil
 }
 
+// Close 关闭AOF文件
 func (Sdb *StandaloneDatabase) Close() {
-
+	// 和 CONFIG SET appendonly no 一样，等正在执行的写命令追加完成之后再关闭AOF文件
+	Sdb.stopAof()
 }
 
 // select 2
@@ -135,6 +283,8 @@ func (Sdb *StandaloneDatabase) loadDB(dbIndex int, newDB *DB) resp.Reply {
 	oldDB, _ := Sdb.selectDB(dbIndex)
 	newDB.index = dbIndex
 	newDB.addAof = oldDB.addAof
+	newDB.addAofMulti = oldDB.addAofMulti
+	newDB.notify = oldDB.notify
 	Sdb.dbSet[dbIndex] = newDB
 	return &reply.OKReply{}
 }
@@ -4,15 +4,28 @@ import (
 	"GoRedis/datastruct/dict"
 	"GoRedis/interface/database"
 	"GoRedis/interface/resp"
+	"GoRedis/lib/sync/lock"
 	"GoRedis/resp/reply"
 	"strings"
+	"time"
+)
+
+const (
+	// 分段锁的数量，必须是2的幂
+	lockerSize = 1024
 )
 
 type DB struct {
 	index int
 	data  dict.Dict
+	// 按key加锁，保证事务和脚本执行的原子性
+	locker *lock.Locks
 	// aof持久化
 	addAof func(line CmdLine)
+	// 将一组命令包在 MULTI/EXEC 中写入aof，用于脚本
+	addAofMulti func(lines []CmdLine)
+	// 键空间通知
+	notify NotifyFunc
 	// 事务相关
 	// 版本map
 	versionMap dict.Dict
@@ -31,9 +44,12 @@ type CmdLine = [][]byte
 
 func makeDB() *DB {
 	db := &DB{
-		data:       dict.MakeSyncDict(),
-		addAof:     func(line CmdLine) {},
-		versionMap: dict.MakeSyncDict(),
+		data:        dict.MakeSyncDict(),
+		locker:      lock.Make(lockerSize),
+		addAof:      func(line CmdLine) {},
+		addAofMulti: func(lines []CmdLine) {},
+		notify:      func(class int, event string, key string) {},
+		versionMap:  dict.MakeSyncDict(),
 	}
 	return db
 }
@@ -72,20 +88,81 @@ func (db *DB) Exec(c resp.Connection, cmdLine CmdLine) resp.Reply {
 	return db.NormalExec(cmdLine)
 }
 
+// NormalExec 给命令涉及的key加锁后执行命令
 func (db *DB) NormalExec(cmdLine CmdLine) resp.Reply {
 	cmdName := strings.ToLower(string(cmdLine[0]))
-	cmd, ok := cmdTable[cmdName]
+	cmd, ok := lookupCommand(cmdName)
 	if !ok {
 		return reply.MakeErrReply("ERR unknown command '" + cmdName + "'")
 	}
 	if !validateArity(cmd.arity, cmdLine) {
+		cmd.stats.reject()
 		return reply.MakeArgNumErrReply(cmdName)
 	}
+	if err := cmd.checkOOM(); err != nil {
+		cmd.stats.reject()
+		return err
+	}
 	prepare := cmd.prepare
-	write, _ := prepare(cmdLine[1:])
+	write, read := prepare(cmdLine[1:])
+	var events []keyspaceEvent
+	result := func() resp.Reply {
+		db.locker.RWLocks(write, read)
+		defer db.locker.RWUnLocks(write, read)
+		db.addVersion(write...)
+		return db.deferNotify(&events).execCommand(cmd, cmdLine)
+	}()
+	// 释放锁之后再发送键空间通知
+	db.publishEvents(events)
+	return result
+}
+
+// execWithLock 执行命令但不加锁，调用者（事务、脚本）需要事先持有相关key的锁
+func (db *DB) execWithLock(cmdLine CmdLine) resp.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := lookupCommand(cmdName)
+	if !ok {
+		return reply.MakeErrReply("ERR unknown command '" + cmdName + "'")
+	}
+	if !validateArity(cmd.arity, cmdLine) {
+		cmd.stats.reject()
+		return reply.MakeArgNumErrReply(cmdName)
+	}
+	write, _ := cmd.prepare(cmdLine[1:])
 	db.addVersion(write...)
-	fun := cmd.executor
-	return fun(db, cmdLine[1:])
+	return db.execCommand(cmd, cmdLine)
+}
+
+// 执行命令并记录耗时，用于 INFO commandstats 和 LATENCY HISTOGRAM
+func (db *DB) execCommand(cmd *command, cmdLine CmdLine) resp.Reply {
+	start := time.Now()
+	result := cmd.executor(db, cmdLine[1:])
+	cmd.stats.record(time.Since(start), result)
+	return result
+}
+
+// 命令执行时产生的键空间事件
+type keyspaceEvent struct {
+	class int
+	event string
+	key   string
+}
+
+// 返回执行命令使用的DB，命令产生的键空间事件暂存在events中
+// 调用者释放key的锁之后通过 publishEvents 发送，订阅者较慢时不会延长写锁的持有时间
+func (db *DB) deferNotify(events *[]keyspaceEvent) *DB {
+	execDB := *db
+	execDB.notify = func(class int, event string, key string) {
+		*events = append(*events, keyspaceEvent{class: class, event: event, key: key})
+	}
+	return &execDB
+}
+
+// 发送暂存的键空间事件
+func (db *DB) publishEvents(events []keyspaceEvent) {
+	for _, e := range events {
+		db.notify(e.class, e.event, e.key)
+	}
 }
 
 // 校验参数个数
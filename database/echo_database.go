@@ -17,10 +17,18 @@ func (e EchoDatabase) Exec(client resp.Connection, args [][]byte) resp.Reply {
 	return reply.MakeMultiBulkReply(args)
 }
 
+func (e EchoDatabase) CheckAuth(client resp.Connection, cmdName string) resp.Reply {
+	return nil
+}
+
 func (e EchoDatabase) AfterClientClose(c resp.Connection) {
 	logger.Info("EchoDatabase AfterClientClose")
 }
 
+func (e EchoDatabase) PrepareShutdown(save bool) error {
+	return nil
+}
+
 func (e EchoDatabase) Close() {
 	logger.Info("EchoDatabase Close")
 
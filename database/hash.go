@@ -55,6 +55,7 @@ func execHSet(db *DB, args [][]byte) resp.Reply {
 
 	result := dict.Put(field, value)
 	db.addAof(utils.ToCmdLine2("hset", args...))
+	db.notify(notifyHash, "hset", key)
 	return reply.MakeIntReply(int64(result))
 }
 
@@ -74,6 +75,7 @@ func execHSetNX(db *DB, args [][]byte) resp.Reply {
 	result := dict.PutIfAbsent(field, value)
 	if result > 0 {
 		db.addAof(utils.ToCmdLine2("hsetnx", args...))
+		db.notify(notifyHash, "hset", key)
 	}
 	return reply.MakeIntReply(int64(result))
 }
@@ -155,12 +157,14 @@ func execHDel(db *DB, args [][]byte) resp.Reply {
 		result := dict.Remove(field)
 		deleted += result
 	}
+	if deleted > 0 {
+		db.addAof(utils.ToCmdLine2("hdel", args...))
+		db.notify(notifyHash, "hdel", key)
+	}
 	// dict里面已经没有键值对，清除这个dict
 	if dict.Len() == 0 {
 		db.Remove(key)
-	}
-	if deleted > 0 {
-		db.addAof(utils.ToCmdLine2("hdel", args...))
+		db.notify(notifyGeneric, "del", key)
 	}
 	return reply.MakeIntReply(int64(deleted))
 }
@@ -210,6 +214,7 @@ func execHMSet(db *DB, args [][]byte) resp.Reply {
 	}
 
 	db.addAof(utils.ToCmdLine2("hmset", args...))
+	db.notify(notifyHash, "hset", key)
 	return &reply.OKReply{}
 }
 
@@ -300,16 +305,14 @@ func execHGetAll(db *DB, args [][]byte) resp.Reply {
 	}
 
 	size := dict.Len()
-	result := make([][]byte, size*2)
-	i := 0
+	result := make([]resp.Reply, 0, size*2)
 	dict.ForEach(func(key string, val interface{}) bool {
-		result[i] = []byte(key)
-		i++
-		result[i], _ = val.([]byte)
-		i++
+		value, _ := val.([]byte)
+		result = append(result, reply.MakeBulkReply([]byte(key)), reply.MakeBulkReply(value))
 		return true
 	})
-	return reply.MakeMultiBulkReply(result[:i])
+	// RESP3客户端收到的是map
+	return reply.MakeMapReply(result)
 }
 
 func undoHSet(db *DB, args [][]byte) []CmdLine {
@@ -340,25 +343,36 @@ func undoHMSet(db *DB, args [][]byte) []CmdLine {
 
 func init() {
 	// 插入一个键值对
-	RegisterCommand("HSet", execHSet, writeFirstKey, undoHSet, 4)
+	RegisterCommand("HSet", execHSet, writeFirstKey, undoHSet, 4).
+		attachInfo(flagWrite|flagDenyOOM|flagFast, 1, 1, 1, aclHash)
 	// 当key不存在时，插入一个键值对
-	RegisterCommand("HSetNX", execHSetNX, writeFirstKey, undoHSet, 4)
+	RegisterCommand("HSetNX", execHSetNX, writeFirstKey, undoHSet, 4).
+		attachInfo(flagWrite|flagDenyOOM|flagFast, 1, 1, 1, aclHash)
 	// 获取key对应的value
-	RegisterCommand("HGet", execHGet, readFirstKey, nil, 3)
+	RegisterCommand("HGet", execHGet, readFirstKey, nil, 3).
+		attachInfo(flagReadOnly|flagFast, 1, 1, 1, aclHash)
 	// 判断key是否存在
-	RegisterCommand("HExists", execHExists, readFirstKey, nil, 3)
+	RegisterCommand("HExists", execHExists, readFirstKey, nil, 3).
+		attachInfo(flagReadOnly|flagFast, 1, 1, 1, aclHash)
 	// 删除一个或多个键值对
-	RegisterCommand("HDel", execHDel, writeFirstKey, undoHDel, -3)
+	RegisterCommand("HDel", execHDel, writeFirstKey, undoHDel, -3).
+		attachInfo(flagWrite|flagFast, 1, 1, 1, aclHash)
 	// 获取哈希表中的键值对个数
-	RegisterCommand("HLen", execHLen, readFirstKey, nil, 2)
+	RegisterCommand("HLen", execHLen, readFirstKey, nil, 2).
+		attachInfo(flagReadOnly|flagFast, 1, 1, 1, aclHash)
 	// 插入数个键值对
-	RegisterCommand("HMSet", execHMSet, writeFirstKey, undoHMSet, -4)
+	RegisterCommand("HMSet", execHMSet, writeFirstKey, undoHMSet, -4).
+		attachInfo(flagWrite|flagDenyOOM|flagFast, 1, 1, 1, aclHash)
 	// 获取数个key对应的value
-	RegisterCommand("HMGet", execHMGet, readFirstKey, nil, -3)
+	RegisterCommand("HMGet", execHMGet, readFirstKey, nil, -3).
+		attachInfo(flagReadOnly|flagFast, 1, 1, 1, aclHash)
 	// 获取所有key
-	RegisterCommand("HKeys", execHKeys, readFirstKey, nil, 2)
+	RegisterCommand("HKeys", execHKeys, readFirstKey, nil, 2).
+		attachInfo(flagReadOnly, 1, 1, 1, aclHash)
 	// 获取所有value
-	RegisterCommand("HVals", execHVals, readFirstKey, nil, 2)
+	RegisterCommand("HVals", execHVals, readFirstKey, nil, 2).
+		attachInfo(flagReadOnly, 1, 1, 1, aclHash)
 	// 获取所有key-value
-	RegisterCommand("HGetAll", execHGetAll, readFirstKey, nil, 2)
+	RegisterCommand("HGetAll", execHGetAll, readFirstKey, nil, 2).
+		attachInfo(flagReadOnly, 1, 1, 1, aclHash)
 }
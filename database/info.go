@@ -0,0 +1,281 @@
+package database
+
+import (
+	"GoRedis/config"
+	"GoRedis/interface/resp"
+	"GoRedis/pubsub"
+	"GoRedis/resp/reply"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/*
+ * INFO 命令
+ * 输出格式和Redis一致，每个部分以 # 开头，每行是 字段:值
+ */
+
+// 服务器启动的时间
+var startTime = time.Now()
+
+// 每次启动随机生成的ID
+var runID = makeRunID()
+
+// 观察到的最大内存占用
+var peakMemory uint64
+
+func makeRunID() string {
+	b := make([]byte, 20)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// HandlerStats 协议层统计的客户端和命令信息
+type HandlerStats struct {
+	// 当前连接的客户端数量
+	ConnectedClients int
+	// 被 CLIENT PAUSE 阻塞的客户端数量
+	BlockedClients int
+	// 接收过的连接总数
+	TotalConnections int64
+	// 因为 maxclients 被拒绝的连接数
+	RejectedConnections int64
+	// 执行过的命令总数
+	TotalCommands int64
+	// 每秒执行的命令数
+	OpsPerSec int64
+}
+
+// StatsFunc 返回协议层的统计信息
+type StatsFunc func() HandlerStats
+
+// SetStatsFunc 设置协议层统计信息的来源
+func (Sdb *StandaloneDatabase) SetStatsFunc(stats StatsFunc) {
+	Sdb.stats = stats
+}
+
+// SetResetStatsFunc 设置 CONFIG RESETSTAT 时清空协议层统计信息的函数
+func (Sdb *StandaloneDatabase) SetResetStatsFunc(reset func()) {
+	Sdb.resetStats = reset
+}
+
+// 生成一个部分的内容，返回的字段按照顺序输出
+type infoSection struct {
+	name string
+	// 是否属于默认输出的部分
+	isDefault bool
+	gen       func(Sdb *StandaloneDatabase) []infoField
+}
+
+type infoField struct {
+	key   string
+	value string
+}
+
+// 所有的部分，按照输出顺序排列
+var infoSections = []*infoSection{
+	{name: "server", isDefault: true, gen: (*StandaloneDatabase).infoServer},
+	{name: "clients", isDefault: true, gen: (*StandaloneDatabase).infoClients},
+	{name: "memory", isDefault: true, gen: (*StandaloneDatabase).infoMemory},
+	{name: "persistence", isDefault: true, gen: (*StandaloneDatabase).infoPersistence},
+	{name: "stats", isDefault: true, gen: (*StandaloneDatabase).infoStats},
+	{name: "commandstats", isDefault: false, gen: (*StandaloneDatabase).infoCommandStats},
+	{name: "errorstats", isDefault: true, gen: (*StandaloneDatabase).infoErrorStats},
+	{name: "keyspace", isDefault: true, gen: (*StandaloneDatabase).infoKeyspace},
+}
+
+// INFO [section [section ...]]
+func (Sdb *StandaloneDatabase) execInfo(args [][]byte) resp.Reply {
+	return reply.MakeVerbatimReply("txt", Sdb.Info(args...))
+}
+
+// Info 返回给定部分的信息，没有给定时返回默认的部分
+func (Sdb *StandaloneDatabase) Info(args ...[]byte) string {
+	selected := make(map[string]bool)
+	all := false
+	if len(args) == 0 {
+		args = [][]byte{[]byte("default")}
+	}
+	for _, arg := range args {
+		name := strings.ToLower(string(arg))
+		switch name {
+		case "all", "everything":
+			all = true
+		case "default":
+			for _, section := range infoSections {
+				if section.isDefault {
+					selected[section.name] = true
+				}
+			}
+		default:
+			selected[name] = true
+		}
+	}
+	var buf strings.Builder
+	for _, section := range infoSections {
+		if !all && !selected[section.name] {
+			continue
+		}
+		if buf.Len() > 0 {
+			buf.WriteString("\r\n")
+		}
+		buf.WriteString("# " + strings.ToUpper(section.name[:1]) + section.name[1:] + "\r\n")
+		for _, field := range section.gen(Sdb) {
+			buf.WriteString(field.key + ":" + field.value + "\r\n")
+		}
+	}
+	return buf.String()
+}
+
+func (Sdb *StandaloneDatabase) infoServer() []infoField {
+	uptime := int64(time.Since(startTime).Seconds())
+	executable, _ := os.Executable()
+	return []infoField{
+		{"redis_version", RedisVersion},
+		{"redis_mode", "standalone"},
+		{"os", runtime.GOOS + " " + runtime.GOARCH},
+		{"arch_bits", strconv.Itoa(32 << (^uint(0) >> 63))},
+		{"go_version", runtime.Version()},
+		{"process_id", strconv.Itoa(os.Getpid())},
+		{"run_id", runID},
+		{"tcp_port", strconv.Itoa(config.Properties().Port)},
+		{"uptime_in_seconds", strconv.FormatInt(uptime, 10)},
+		{"uptime_in_days", strconv.FormatInt(uptime/86400, 10)},
+		{"executable", executable},
+	}
+}
+
+func (Sdb *StandaloneDatabase) infoClients() []infoField {
+	stats := Sdb.stats()
+	return []infoField{
+		{"connected_clients", strconv.Itoa(stats.ConnectedClients)},
+		{"maxclients", strconv.Itoa(config.Properties().MaxClients)},
+		{"blocked_clients", strconv.Itoa(stats.BlockedClients)},
+	}
+}
+
+func (Sdb *StandaloneDatabase) infoMemory() []infoField {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	used := m.HeapAlloc
+	for {
+		peak := atomic.LoadUint64(&peakMemory)
+		if used <= peak || atomic.CompareAndSwapUint64(&peakMemory, peak, used) {
+			break
+		}
+	}
+	peak := atomic.LoadUint64(&peakMemory)
+	rss := residentMemory()
+	if rss == 0 {
+		rss = m.Sys
+	}
+	return []infoField{
+		{"used_memory", strconv.FormatUint(used, 10)},
+		{"used_memory_human", bytesToHuman(used)},
+		{"used_memory_rss", strconv.FormatUint(rss, 10)},
+		{"used_memory_rss_human", bytesToHuman(rss)},
+		{"used_memory_peak", strconv.FormatUint(peak, 10)},
+		{"used_memory_peak_human", bytesToHuman(peak)},
+		{"heap_sys", strconv.FormatUint(m.HeapSys, 10)},
+		{"heap_objects", strconv.FormatUint(m.HeapObjects, 10)},
+		{"gc_cycles", strconv.FormatUint(uint64(m.NumGC), 10)},
+		{"goroutines", strconv.Itoa(runtime.NumGoroutine())},
+		{"maxmemory", strconv.Itoa(config.Properties().MaxMemory)},
+		{"maxmemory_human", bytesToHuman(uint64(config.Properties().MaxMemory))},
+		{"maxmemory_policy", "noeviction"},
+		{"mem_allocator", "go"},
+	}
+}
+
+func (Sdb *StandaloneDatabase) infoPersistence() []infoField {
+	handler := Sdb.aof()
+	fields := []infoField{
+		{"loading", "0"},
+		{"aof_enabled", boolToInfo(handler != nil)},
+		{"aof_rewrite_in_progress", "0"},
+	}
+	if handler == nil {
+		return fields
+	}
+	status := "ok"
+	if !handler.LastWriteOK() {
+		status = "err"
+	}
+	return append(fields,
+		infoField{"aof_last_write_status", status},
+		infoField{"aof_buffer_length", strconv.Itoa(handler.PendingLen())},
+	)
+}
+
+func (Sdb *StandaloneDatabase) infoStats() []infoField {
+	stats := Sdb.stats()
+	return []infoField{
+		{"total_connections_received", strconv.FormatInt(stats.TotalConnections, 10)},
+		{"total_commands_processed", strconv.FormatInt(stats.TotalCommands, 10)},
+		{"instantaneous_ops_per_sec", strconv.FormatInt(stats.OpsPerSec, 10)},
+		{"rejected_connections", strconv.FormatInt(stats.RejectedConnections, 10)},
+		{"total_error_replies", strconv.FormatInt(atomic.LoadInt64(&totalErrorReplies), 10)},
+		{"pubsub_channels", strconv.Itoa(pubsub.NumChannels(Sdb.hub))},
+		{"pubsub_patterns", strconv.Itoa(pubsub.NumPatterns(Sdb.hub))},
+	}
+}
+
+// 只输出有key的数据库，目前不支持过期时间
+func (Sdb *StandaloneDatabase) infoKeyspace() []infoField {
+	fields := make([]infoField, 0)
+	for i, db := range Sdb.dbSet {
+		keys := db.data.Len()
+		if keys == 0 {
+			continue
+		}
+		fields = append(fields, infoField{
+			"db" + strconv.Itoa(i),
+			"keys=" + strconv.Itoa(keys) + ",expires=0,avg_ttl=0",
+		})
+	}
+	return fields
+}
+
+func boolToInfo(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// 转换成 1.50M 这样的格式
+func bytesToHuman(n uint64) string {
+	units := []string{"B", "K", "M", "G", "T"}
+	value := float64(n)
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	if i == 0 {
+		return strconv.FormatUint(n, 10) + "B"
+	}
+	return strconv.FormatFloat(value, 'f', 2, 64) + units[i]
+}
+
+// 从 /proc/self/statm 读取常驻内存，其他系统返回0
+func residentMemory() uint64 {
+	data, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return 0
+	}
+	pages, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return pages * uint64(os.Getpagesize())
+}
@@ -17,7 +17,14 @@ func execDel(db *DB, args [][]byte) resp.Reply {
 	for i, v := range args {
 		keys[i] = string(v)
 	}
-	deleted := db.Removes(keys...)
+	deleted := 0
+	for _, key := range keys {
+		if _, exists := db.GetEntity(key); exists {
+			db.Remove(key)
+			db.notify(notifyGeneric, "del", key)
+			deleted++
+		}
+	}
 	if deleted > 0 {
 		db.addAof(utils.ToCmdLine2("del", args...))
 	}
@@ -78,6 +85,8 @@ func execRename(db *DB, args [][]byte) resp.Reply {
 	db.PutEntity(dest, entity)
 	db.Remove(src)
 	db.addAof(utils.ToCmdLine2("rename", args...))
+	db.notify(notifyGeneric, "rename_from", src)
+	db.notify(notifyGeneric, "rename_to", dest)
 	return reply.MakeOkReply()
 }
 
@@ -98,6 +107,8 @@ func execRenamenx(db *DB, args [][]byte) resp.Reply {
 	db.PutEntity(dest, entity)
 	db.Remove(src)
 	db.addAof(utils.ToCmdLine2("renamenx", args...))
+	db.notify(notifyGeneric, "rename_from", src)
+	db.notify(notifyGeneric, "rename_to", dest)
 	return reply.MakeOkReply()
 }
 
@@ -135,10 +146,16 @@ func prepareRename(args [][]byte) ([]string, []string) {
 }
 
 func init() {
-	RegisterCommand("DEL", execDel, writeAllKeys, undoDel, -2)
-	RegisterCommand("EXISTS", execExists, readAllKeys, nil, -2)
-	RegisterCommand("type", execType, readFirstKey, nil, 2)
-	RegisterCommand("RENAME", execRename, prepareRename, undoRename, 3)
-	RegisterCommand("RENAMENX", execRenamenx, prepareRename, undoRename, 3)
-	RegisterCommand("KEYS", execKeys, noPrepare, nil, 2)
+	RegisterCommand("DEL", execDel, writeAllKeys, undoDel, -2).
+		attachInfo(flagWrite, 1, -1, 1, aclKeyspace)
+	RegisterCommand("EXISTS", execExists, readAllKeys, nil, -2).
+		attachInfo(flagReadOnly|flagFast, 1, -1, 1, aclKeyspace)
+	RegisterCommand("type", execType, readFirstKey, nil, 2).
+		attachInfo(flagReadOnly|flagFast, 1, 1, 1, aclKeyspace)
+	RegisterCommand("RENAME", execRename, prepareRename, undoRename, 3).
+		attachInfo(flagWrite, 1, 2, 1, aclKeyspace)
+	RegisterCommand("RENAMENX", execRenamenx, prepareRename, undoRename, 3).
+		attachInfo(flagWrite|flagFast, 1, 2, 1, aclKeyspace)
+	RegisterCommand("KEYS", execKeys, noPrepare, nil, 2).
+		attachInfo(flagReadOnly, 0, 0, 0, aclKeyspace, aclDangerous)
 }
@@ -53,6 +53,7 @@ func execLPush(db *DB, args [][]byte) resp.Reply {
 		list.Insert(0, value)
 	}
 	db.addAof(utils.ToCmdLine2("lpush", args...))
+	db.notify(notifyList, "lpush", key)
 	return reply.MakeIntReply(int64(list.Len()))
 }
 
@@ -75,6 +76,7 @@ func execLPushX(db *DB, args [][]byte) resp.Reply {
 		list.Insert(0, value)
 	}
 	db.addAof(utils.ToCmdLine2("lpushx", args...))
+	db.notify(notifyList, "lpush", key)
 	return reply.MakeIntReply(int64(list.Len()))
 }
 
@@ -93,6 +95,7 @@ func execRPush(db *DB, args [][]byte) resp.Reply {
 	}
 
 	db.addAof(utils.ToCmdLine2("rpush", args...))
+	db.notify(notifyList, "rpush", key)
 	return reply.MakeIntReply(int64(list.Len()))
 }
 
@@ -115,6 +118,7 @@ func execRPushX(db *DB, args [][]byte) resp.Reply {
 	}
 
 	db.addAof(utils.ToCmdLine2("rpush", args...))
+	db.notify(notifyList, "rpush", key)
 	return reply.MakeIntReply(int64(list.Len()))
 }
 
@@ -133,9 +137,11 @@ func execLPop(db *DB, args [][]byte) resp.Reply {
 	}
 
 	val, _ := list.Remove(0).([]byte)
+	db.notify(notifyList, "lpop", key)
 	// 如果删除的是最后一个元素
 	if list.Len() == 0 {
 		db.Remove(key)
+		db.notify(notifyGeneric, "del", key)
 	}
 
 	db.addAof(utils.ToCmdLine2("lpop", args...))
@@ -157,9 +163,11 @@ func execRPop(db *DB, args [][]byte) resp.Reply {
 	}
 
 	val, _ := list.RemoveLast().([]byte)
+	db.notify(notifyList, "rpop", key)
 	// 如果删除的是最后一个元素
 	if list.Len() == 0 {
 		db.Remove(key)
+		db.notify(notifyGeneric, "del", key)
 	}
 
 	db.addAof(utils.ToCmdLine2("rpop", args...))
@@ -200,12 +208,14 @@ func execLRem(db *DB, args [][]byte) resp.Reply {
 		}, -count)
 	}
 
-	if list.Len() == 0 {
-		db.Remove(key)
-	}
-
 	if removed > 0 {
 		db.addAof(utils.ToCmdLine2("lrem", args...))
+		db.notify(notifyList, "lrem", key)
+	}
+
+	if list.Len() == 0 {
+		db.Remove(key)
+		db.notify(notifyGeneric, "del", key)
 	}
 
 	return reply.MakeIntReply(int64(removed))
@@ -286,6 +296,7 @@ func execLSet(db *DB, args [][]byte) resp.Reply {
 
 	list.Set(index, value)
 	db.addAof(utils.ToCmdLine2("lset", args...))
+	db.notify(notifyList, "lset", key)
 	return &reply.OKReply{}
 }
 
@@ -470,26 +481,37 @@ func undoLSet(db *DB, args [][]byte) []CmdLine {
 
 func init() {
 	// 头插
-	RegisterCommand("LPush", execLPush, writeFirstKey, undoLPush, -3)
-	RegisterCommand("LPushX", execLPushX, writeFirstKey, undoLPush, -3)
+	RegisterCommand("LPush", execLPush, writeFirstKey, undoLPush, -3).
+		attachInfo(flagWrite|flagDenyOOM|flagFast, 1, 1, 1, aclList)
+	RegisterCommand("LPushX", execLPushX, writeFirstKey, undoLPush, -3).
+		attachInfo(flagWrite|flagDenyOOM|flagFast, 1, 1, 1, aclList)
 	// 尾插
-	RegisterCommand("RPush", execRPush, writeFirstKey, undoLPush, -3)
-	RegisterCommand("RPushX", execRPushX, writeFirstKey, undoRPush, -3)
+	RegisterCommand("RPush", execRPush, writeFirstKey, undoLPush, -3).
+		attachInfo(flagWrite|flagDenyOOM|flagFast, 1, 1, 1, aclList)
+	RegisterCommand("RPushX", execRPushX, writeFirstKey, undoRPush, -3).
+		attachInfo(flagWrite|flagDenyOOM|flagFast, 1, 1, 1, aclList)
 	// 弹出头部元素
-	RegisterCommand("LPop", execLPop, writeFirstKey, undoLPop, 2)
+	RegisterCommand("LPop", execLPop, writeFirstKey, undoLPop, 2).
+		attachInfo(flagWrite|flagFast, 1, 1, 1, aclList)
 	// 弹出尾部元素
-	RegisterCommand("RPop", execRPop, writeFirstKey, undoRPop, 2)
+	RegisterCommand("RPop", execRPop, writeFirstKey, undoRPop, 2).
+		attachInfo(flagWrite|flagFast, 1, 1, 1, aclList)
 	// 根据count删除元素
 	// count == 0 删除等于value的所有元素
 	// count > 0  顺序删除count个value元素
 	// count < 0  逆序删除-count个value元素
-	RegisterCommand("LRem", execLRem, writeFirstKey, rollbackFirstKey, 4)
+	RegisterCommand("LRem", execLRem, writeFirstKey, rollbackFirstKey, 4).
+		attachInfo(flagWrite, 1, 1, 1, aclList)
 	// 获取列表长度
-	RegisterCommand("LLen", execLLen, readFirstKey, nil, 2)
+	RegisterCommand("LLen", execLLen, readFirstKey, nil, 2).
+		attachInfo(flagReadOnly|flagFast, 1, 1, 1, aclList)
 	// 根据下标获取元素
-	RegisterCommand("LIndex", execLIndex, readFirstKey, nil, 3)
+	RegisterCommand("LIndex", execLIndex, readFirstKey, nil, 3).
+		attachInfo(flagReadOnly, 1, 1, 1, aclList)
 	// 设置指定下标处的值为value（覆盖原值）
-	RegisterCommand("LSet", execLSet, writeFirstKey, undoLSet, 4)
+	RegisterCommand("LSet", execLSet, writeFirstKey, undoLSet, 4).
+		attachInfo(flagWrite|flagDenyOOM, 1, 1, 1, aclList)
 	// 返回指定区间的元素（返回一个切片）
-	RegisterCommand("LRange", execLRange, readFirstKey, nil, 4)
+	RegisterCommand("LRange", execLRange, readFirstKey, nil, 4).
+		attachInfo(flagReadOnly, 1, 1, 1, aclList)
 }
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"GoRedis/config"
+	"GoRedis/resp/reply"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+/*
+ * maxmemory 限制
+ * 目前不支持淘汰key，相当于Redis的 noeviction 策略：
+ * 内存超过限制之后拒绝带有 denyoom 标志的命令，其他命令正常执行
+ */
+
+// 读取内存使用量的最小间隔，runtime.ReadMemStats 会暂停所有协程，不能每条命令都调用
+const memorySampleInterval = 100 * time.Millisecond
+
+var (
+	// 最近一次采样的内存使用量
+	sampledMemory uint64
+	// 最近一次采样的时间，UnixNano
+	lastMemorySample int64
+)
+
+// 返回最近采样的堆内存使用量，距离上次采样超过间隔时重新采样
+func usedMemory() uint64 {
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&lastMemorySample)
+	if now-last >= int64(memorySampleInterval) && atomic.CompareAndSwapInt64(&lastMemorySample, last, now) {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		atomic.StoreUint64(&sampledMemory, m.HeapAlloc)
+	}
+	return atomic.LoadUint64(&sampledMemory)
+}
+
+// 内存使用量超过 maxmemory 时，返回拒绝命令的错误
+func (cmd *command) checkOOM() *reply.StandardErrReply {
+	if cmd.flags&flagDenyOOM == 0 {
+		return nil
+	}
+	maxMemory := config.Properties().MaxMemory
+	if maxMemory <= 0 || usedMemory() <= uint64(maxMemory) {
+		return nil
+	}
+	return reply.MakeErrReply("OOM command not allowed when used memory > 'maxmemory'.")
+}
@@ -0,0 +1,163 @@
+package database
+
+import (
+	"GoRedis/config"
+	"GoRedis/lib/metrics"
+	"GoRedis/pubsub"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+/*
+ * Prometheus 指标
+ * 和 INFO 使用同样的数据，指标名以 goredis_ 开头，Go 运行时的指标以 go_ 开头
+ */
+
+// Collect 输出所有指标
+func (Sdb *StandaloneDatabase) Collect(w *metrics.Writer) {
+	Sdb.collectServer(w)
+	collectCommands(w)
+	Sdb.collectKeyspace(w)
+	Sdb.collectPersistence(w)
+	Sdb.collectPubSub(w)
+	collectRuntime(w)
+}
+
+func (Sdb *StandaloneDatabase) collectServer(w *metrics.Writer) {
+	stats := Sdb.stats()
+	w.Single("goredis_uptime_seconds", metrics.Gauge,
+		"Number of seconds since the server started.", time.Since(startTime).Seconds())
+	w.Single("goredis_connected_clients", metrics.Gauge,
+		"Number of client connections.", float64(stats.ConnectedClients))
+	w.Single("goredis_blocked_clients", metrics.Gauge,
+		"Number of clients blocked by CLIENT PAUSE.", float64(stats.BlockedClients))
+	w.Single("goredis_max_clients", metrics.Gauge,
+		"Maximum number of connected clients.", float64(config.Properties().MaxClients))
+	w.Single("goredis_connections_received_total", metrics.Counter,
+		"Total number of connections accepted.", float64(stats.TotalConnections))
+	w.Single("goredis_rejected_connections_total", metrics.Counter,
+		"Total number of connections rejected because of maxclients.", float64(stats.RejectedConnections))
+	w.Single("goredis_commands_processed_total", metrics.Counter,
+		"Total number of commands processed.", float64(stats.TotalCommands))
+	w.Single("goredis_error_replies_total", metrics.Counter,
+		"Total number of error replies.", float64(atomic.LoadInt64(&totalErrorReplies)))
+
+	w.Family("goredis_errors_total", metrics.Counter, "Total number of error replies by error prefix.")
+	errorStats.Range(func(key, value interface{}) bool {
+		w.Sample("goredis_errors_total", float64(atomic.LoadInt64(value.(*int64))), "prefix", key.(string))
+		return true
+	})
+}
+
+// 每个命令的调用次数、耗时和延迟直方图，只输出调用过的命令
+func collectCommands(w *metrics.Writer) {
+	names := make([]string, 0)
+	for _, name := range sortedCommandNames() {
+		stats := cmdTable[name].stats
+		if atomic.LoadInt64(&stats.calls) > 0 || atomic.LoadInt64(&stats.rejectedCalls) > 0 {
+			names = append(names, name)
+		}
+	}
+
+	counters := []struct {
+		name  string
+		help  string
+		value func(s *commandStats) float64
+	}{
+		{"goredis_command_calls_total", "Total number of calls per command.",
+			func(s *commandStats) float64 { return float64(atomic.LoadInt64(&s.calls)) }},
+		{"goredis_command_duration_seconds_total", "Total time spent executing each command.",
+			func(s *commandStats) float64 { return float64(atomic.LoadInt64(&s.usec)) / 1e6 }},
+		{"goredis_command_rejected_calls_total", "Total number of calls rejected before execution per command.",
+			func(s *commandStats) float64 { return float64(atomic.LoadInt64(&s.rejectedCalls)) }},
+		{"goredis_command_failed_calls_total", "Total number of calls that returned an error per command.",
+			func(s *commandStats) float64 { return float64(atomic.LoadInt64(&s.failedCalls)) }},
+	}
+	for _, counter := range counters {
+		w.Family(counter.name, metrics.Counter, counter.help)
+		for _, name := range names {
+			w.Sample(counter.name, counter.value(cmdTable[name].stats), "cmd", name)
+		}
+	}
+
+	// 最后一个桶包含更慢的调用，只作为 +Inf 输出
+	const histogram = "goredis_command_latency_seconds"
+	w.Family(histogram, metrics.Histogram, "Command execution latency.")
+	for _, name := range names {
+		stats := cmdTable[name].stats
+		var count int64
+		for i := 0; i < histogramBuckets-1; i++ {
+			count += atomic.LoadInt64(&stats.histogram[i])
+			le := float64(int64(1)<<uint(i)) / 1e6
+			w.Sample(histogram+"_bucket", float64(count), "cmd", name, "le", metrics.FormatFloat(le))
+		}
+		count += atomic.LoadInt64(&stats.histogram[histogramBuckets-1])
+		w.Sample(histogram+"_bucket", float64(count), "cmd", name, "le", "+Inf")
+		w.Sample(histogram+"_sum", float64(atomic.LoadInt64(&stats.usec))/1e6, "cmd", name)
+		w.Sample(histogram+"_count", float64(count), "cmd", name)
+	}
+}
+
+func (Sdb *StandaloneDatabase) collectKeyspace(w *metrics.Writer) {
+	w.Family("goredis_db_keys", metrics.Gauge, "Number of keys in each database.")
+	for i, db := range Sdb.dbSet {
+		w.Sample("goredis_db_keys", float64(db.data.Len()), "db", "db"+strconv.Itoa(i))
+	}
+}
+
+func (Sdb *StandaloneDatabase) collectPersistence(w *metrics.Writer) {
+	handler := Sdb.aof()
+	enabled := handler != nil
+	w.Single("goredis_aof_enabled", metrics.Gauge,
+		"Whether AOF persistence is enabled.", boolToFloat(enabled))
+	if !enabled {
+		return
+	}
+	w.Single("goredis_aof_pending_commands", metrics.Gauge,
+		"Number of commands waiting to be written to the AOF file.", float64(handler.PendingLen()))
+	w.Single("goredis_aof_last_write_ok", metrics.Gauge,
+		"Whether the last write to the AOF file succeeded.", boolToFloat(handler.LastWriteOK()))
+	w.Single("goredis_aof_write_errors_total", metrics.Counter,
+		"Total number of failed writes to the AOF file.", float64(handler.WriteErrors()))
+}
+
+func (Sdb *StandaloneDatabase) collectPubSub(w *metrics.Writer) {
+	w.Single("goredis_pubsub_channels", metrics.Gauge,
+		"Number of channels with at least one subscriber.", float64(pubsub.NumChannels(Sdb.hub)))
+	w.Single("goredis_pubsub_patterns", metrics.Gauge,
+		"Number of patterns with at least one subscriber.", float64(pubsub.NumPatterns(Sdb.hub)))
+	w.Single("goredis_pubsub_subscribers", metrics.Gauge,
+		"Total number of channel subscriptions.", float64(pubsub.NumSubscribers(Sdb.hub)))
+}
+
+func collectRuntime(w *metrics.Writer) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	w.Single("go_goroutines", metrics.Gauge,
+		"Number of goroutines that currently exist.", float64(runtime.NumGoroutine()))
+	w.Single("go_memstats_alloc_bytes", metrics.Gauge,
+		"Number of bytes allocated and still in use.", float64(m.HeapAlloc))
+	w.Single("go_memstats_sys_bytes", metrics.Gauge,
+		"Number of bytes obtained from system.", float64(m.Sys))
+	w.Single("go_memstats_heap_objects", metrics.Gauge,
+		"Number of allocated objects.", float64(m.HeapObjects))
+	w.Single("go_memstats_gc_cycles_total", metrics.Counter,
+		"Number of completed GC cycles.", float64(m.NumGC))
+	w.Single("go_memstats_gc_pause_seconds_total", metrics.Counter,
+		"Total time spent in GC pauses.", float64(m.PauseTotalNs)/1e9)
+	if rss := residentMemory(); rss > 0 {
+		w.Single("process_resident_memory_bytes", metrics.Gauge,
+			"Resident memory size in bytes.", float64(rss))
+	}
+	w.Single("process_start_time_seconds", metrics.Gauge,
+		"Start time of the process since unix epoch in seconds.", float64(startTime.UnixNano())/1e9)
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,178 @@
+package database
+
+import (
+	"GoRedis/interface/resp"
+	"GoRedis/resp/reply"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+ * MONITOR
+ * 执行 MONITOR 的客户端会收到所有客户端执行的命令
+ * 命令先格式化后放入缓冲通道，由单独的协程发送给监视器，发送缓慢不会阻塞执行命令的客户端
+ */
+
+// 等待发送的消息最多缓存多少条，缓冲区满时丢弃新的消息
+const monitorFeedSize = 1024
+
+// 监视器集合
+type monitors struct {
+	mu      sync.Mutex
+	clients map[resp.Connection]struct{}
+	// 监视器的数量，没有监视器时不格式化命令
+	count int32
+	// 等待发送的消息
+	feed chan []byte
+}
+
+func makeMonitors() *monitors {
+	m := &monitors{
+		clients: make(map[resp.Connection]struct{}),
+		feed:    make(chan []byte, monitorFeedSize),
+	}
+	go m.loop()
+	return m
+}
+
+// 将客户端切换为监视器
+func (m *monitors) add(c resp.Connection) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.clients[c]; ok {
+		return
+	}
+	c.SetMonitor()
+	m.clients[c] = struct{}{}
+	atomic.AddInt32(&m.count, 1)
+}
+
+// 客户端断开时删除监视器
+func (m *monitors) remove(c resp.Connection) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.clients[c]; !ok {
+		return
+	}
+	delete(m.clients, c)
+	atomic.AddInt32(&m.count, -1)
+}
+
+// 将一条命令发送给所有监视器
+func (m *monitors) publish(c resp.Connection, cmdLine [][]byte) {
+	if atomic.LoadInt32(&m.count) == 0 {
+		return
+	}
+	line := formatMonitorLine(time.Now(), c.GetDBIndex(), c.Addr(), cmdLine)
+	select {
+	case m.feed <- line:
+	default:
+	}
+}
+
+// 发送协程
+func (m *monitors) loop() {
+	for line := range m.feed {
+		m.mu.Lock()
+		clients := make([]resp.Connection, 0, len(m.clients))
+		for c := range m.clients {
+			clients = append(clients, c)
+		}
+		m.mu.Unlock()
+		// 发送缓慢的监视器由输出缓冲区限制断开
+		for _, c := range clients {
+			_ = c.Write(line)
+		}
+	}
+}
+
+// MONITOR
+func (m *monitors) exec(c resp.Connection) resp.Reply {
+	if c.InMultiState() {
+		return reply.MakeErrReply("ERR MONITOR isn't allowed in MULTI")
+	}
+	m.add(c)
+	return reply.MakeOkReply()
+}
+
+// +1339518083.107412 [0 127.0.0.1:60866] "keys" "*"
+func formatMonitorLine(t time.Time, dbIndex int, addr string, cmdLine [][]byte) []byte {
+	var b strings.Builder
+	b.WriteByte('+')
+	b.WriteString(strconv.FormatInt(t.Unix(), 10))
+	b.WriteByte('.')
+	usec := strconv.Itoa(t.Nanosecond() / 1000)
+	b.WriteString(strings.Repeat("0", 6-len(usec)) + usec)
+	b.WriteString(" [" + strconv.Itoa(dbIndex) + " " + addr + "]")
+	args := redactArgs(cmdLine)
+	for _, arg := range args {
+		b.WriteByte(' ')
+		writeQuoted(&b, arg)
+	}
+	b.WriteString(reply.CRLF)
+	return []byte(b.String())
+}
+
+var redacted = []byte("(redacted)")
+
+// 隐藏 AUTH 和 HELLO AUTH 中的密码
+func redactArgs(cmdLine [][]byte) [][]byte {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	if cmdName == "auth" {
+		args := make([][]byte, len(cmdLine))
+		args[0] = cmdLine[0]
+		for i := 1; i < len(args); i++ {
+			args[i] = redacted
+		}
+		return args
+	}
+	if cmdName == "hello" {
+		var args [][]byte
+		for i := 1; i < len(cmdLine); i++ {
+			if strings.ToLower(string(cmdLine[i])) == "auth" && i+2 < len(cmdLine) {
+				if args == nil {
+					args = append([][]byte{}, cmdLine...)
+				}
+				args[i+1] = redacted
+				args[i+2] = redacted
+				i += 2
+			}
+		}
+		if args != nil {
+			return args
+		}
+	}
+	return cmdLine
+}
+
+// 给参数加上引号，转义特殊字符和不可打印的字符
+func writeQuoted(b *strings.Builder, arg []byte) {
+	b.WriteByte('"')
+	for _, c := range arg {
+		switch c {
+		case '\\', '"':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString("\\n")
+		case '\r':
+			b.WriteString("\\r")
+		case '\t':
+			b.WriteString("\\t")
+		case '\a':
+			b.WriteString("\\a")
+		case '\b':
+			b.WriteString("\\b")
+		default:
+			if c < 0x20 || c > 0x7e {
+				b.WriteString("\\x" + strconv.FormatInt(int64(c)>>4, 16) + strconv.FormatInt(int64(c)&0xf, 16))
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+}
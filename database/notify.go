@@ -0,0 +1,114 @@
+package database
+
+import (
+	"GoRedis/config"
+	"GoRedis/pubsub"
+	"errors"
+	"strconv"
+	"sync/atomic"
+)
+
+/*
+ * 键空间通知
+ * 由 notify-keyspace-events 配置开启，命令修改key之后通过发布/订阅发送两类消息：
+ * __keyspace@<db>__:<key> 消息内容是事件名称
+ * __keyevent@<db>__:<event> 消息内容是key
+ * 命令执行时产生的事件先暂存，命令释放key的锁之后再发送
+ */
+
+// 事件类型
+const (
+	// K 发送 __keyspace@<db>__ 消息
+	notifyKeyspace = 1 << iota
+	// E 发送 __keyevent@<db>__ 消息
+	notifyKeyevent
+	// g 通用命令，比如 DEL、RENAME
+	notifyGeneric
+	// $ 字符串命令
+	notifyString
+	// l 列表命令
+	notifyList
+	// s 集合命令
+	notifySet
+	// h 哈希命令
+	notifyHash
+	// z 有序集合命令
+	notifyZSet
+	// x 过期事件
+	notifyExpired
+	// e 淘汰事件
+	notifyEvicted
+	// A 是 g$lshzxe 的别名
+	notifyAll = notifyGeneric | notifyString | notifyList | notifySet | notifyHash | notifyZSet | notifyExpired | notifyEvicted
+)
+
+// NotifyFunc 发送键空间通知
+type NotifyFunc func(class int, event string, key string)
+
+// ParseKeyspaceEvents 将 notify-keyspace-events 的配置转换成事件类型
+func ParseKeyspaceEvents(classes string) (int, error) {
+	flags := 0
+	for _, c := range classes {
+		switch c {
+		case 'A':
+			flags |= notifyAll
+		case 'g':
+			flags |= notifyGeneric
+		case '$':
+			flags |= notifyString
+		case 'l':
+			flags |= notifyList
+		case 's':
+			flags |= notifySet
+		case 'h':
+			flags |= notifyHash
+		case 'z':
+			flags |= notifyZSet
+		case 'x':
+			flags |= notifyExpired
+		case 'e':
+			flags |= notifyEvicted
+		case 'K':
+			flags |= notifyKeyspace
+		case 'E':
+			flags |= notifyKeyevent
+		default:
+			return 0, errors.New("Invalid event class character. Use 'Ag$lshzxeKE'.")
+		}
+	}
+	return flags, nil
+}
+
+func init() {
+	// 配置文件中的错误在启动时报出
+	config.RegisterValidator("notify-keyspace-events", func(value string) error {
+		_, err := ParseKeyspaceEvents(value)
+		return err
+	})
+}
+
+// 根据当前的配置发送键空间通知
+func (Sdb *StandaloneDatabase) notifyKeyspaceEvent(dbIndex int, class int, event string, key string) {
+	flags := int(atomic.LoadInt32(&Sdb.notifyFlags))
+	if flags&class == 0 {
+		return
+	}
+	if flags&notifyKeyspace != 0 {
+		channel := "__keyspace@" + strconv.Itoa(dbIndex) + "__:" + key
+		pubsub.Publish(Sdb.hub, [][]byte{[]byte(channel), []byte(event)})
+	}
+	if flags&notifyKeyevent != 0 {
+		channel := "__keyevent@" + strconv.Itoa(dbIndex) + "__:" + event
+		pubsub.Publish(Sdb.hub, [][]byte{[]byte(channel), []byte(key)})
+	}
+}
+
+// SetKeyspaceEvents 修改 notify-keyspace-events 配置
+func (Sdb *StandaloneDatabase) SetKeyspaceEvents(classes string) error {
+	flags, err := ParseKeyspaceEvents(classes)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt32(&Sdb.notifyFlags, int32(flags))
+	return nil
+}
@@ -11,5 +11,6 @@ func Ping(db *DB, args [][]byte) resp.Reply {
 
 // 注册ping命令
 func init() {
-	RegisterCommand("ping", Ping, noPrepare, nil, 1)
+	RegisterCommand("ping", Ping, noPrepare, nil, 1).
+		attachInfo(flagStale|flagFast, 0, 0, 0, aclConnection)
 }
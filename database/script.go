@@ -0,0 +1,470 @@
+package database
+
+import (
+	"GoRedis/interface/resp"
+	"GoRedis/resp/reply"
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+/*
+ * Lua脚本
+ * 脚本通过 redis.call/redis.pcall 调用cmdTable中的命令
+ * 执行脚本前会给KEYS中声明的key加锁，脚本中的命令直接执行，不再加锁，所以整个脚本是原子的
+ * 脚本中的命令只能访问KEYS中声明的key，访问其他key会返回错误
+ * aof中记录的是脚本产生的效果而不是脚本本身，脚本中的写命令在脚本结束后包在 MULTI/EXEC 中一起写入aof
+ */
+
+// 脚本缓存，key是脚本的sha1
+type scriptCache struct {
+	mu      sync.RWMutex
+	scripts map[string]*lua.FunctionProto
+}
+
+var scripts = &scriptCache{
+	scripts: make(map[string]*lua.FunctionProto),
+}
+
+// 计算脚本的sha1
+func sha1hex(src string) string {
+	sum := sha1.Sum([]byte(src))
+	return hex.EncodeToString(sum[:])
+}
+
+// 编译脚本并存入缓存
+func (cache *scriptCache) load(src string) (string, *lua.FunctionProto, error) {
+	sha := sha1hex(src)
+	cache.mu.RLock()
+	proto, ok := cache.scripts[sha]
+	cache.mu.RUnlock()
+	if ok {
+		return sha, proto, nil
+	}
+	chunk, err := parse.Parse(strings.NewReader(src), "@user_script")
+	if err != nil {
+		return sha, nil, err
+	}
+	proto, err = lua.Compile(chunk, "f_"+sha)
+	if err != nil {
+		return sha, nil, err
+	}
+	cache.mu.Lock()
+	cache.scripts[sha] = proto
+	cache.mu.Unlock()
+	return sha, proto, nil
+}
+
+// 根据sha1获取脚本
+func (cache *scriptCache) get(sha string) (*lua.FunctionProto, bool) {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+	proto, ok := cache.scripts[strings.ToLower(sha)]
+	return proto, ok
+}
+
+// 判断脚本是否存在
+func (cache *scriptCache) exists(sha string) bool {
+	_, ok := cache.get(sha)
+	return ok
+}
+
+// 清空脚本缓存
+func (cache *scriptCache) flush() {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.scripts = make(map[string]*lua.FunctionProto)
+}
+
+// EVAL script numkeys key [key ...] arg [arg ...]
+func execEval(db *DB, args [][]byte) resp.Reply {
+	sha, proto, err := scripts.load(string(args[0]))
+	if err != nil {
+		return compileErrReply(err)
+	}
+	return db.runScript(sha, proto, args[1:])
+}
+
+// EVALSHA sha1 numkeys key [key ...] arg [arg ...]
+func execEvalSha(db *DB, args [][]byte) resp.Reply {
+	sha := strings.ToLower(string(args[0]))
+	proto, ok := scripts.get(sha)
+	if !ok {
+		return reply.MakeErrReply("NOSCRIPT No matching script. Please use EVAL.")
+	}
+	return db.runScript(sha, proto, args[1:])
+}
+
+// SCRIPT LOAD|EXISTS|FLUSH
+func execScript(db *DB, args [][]byte) resp.Reply {
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "load":
+		if len(args) != 2 {
+			return reply.MakeErrReply("ERR wrong number of arguments for 'script|load' command")
+		}
+		sha, _, err := scripts.load(string(args[1]))
+		if err != nil {
+			return compileErrReply(err)
+		}
+		return reply.MakeBulkReply([]byte(sha))
+	case "exists":
+		if len(args) < 2 {
+			return reply.MakeErrReply("ERR wrong number of arguments for 'script|exists' command")
+		}
+		results := make([]resp.Reply, len(args)-1)
+		for i, sha := range args[1:] {
+			if scripts.exists(string(sha)) {
+				results[i] = reply.MakeIntReply(1)
+			} else {
+				results[i] = reply.MakeIntReply(0)
+			}
+		}
+		return reply.MakeMultiRawReply(results)
+	case "flush":
+		// ASYNC和SYNC效果相同，缓存直接被替换
+		if len(args) > 2 {
+			return reply.MakeErrReply("ERR wrong number of arguments for 'script|flush' command")
+		}
+		if len(args) == 2 {
+			mode := strings.ToLower(string(args[1]))
+			if mode != "async" && mode != "sync" {
+				return reply.MakeErrReply("ERR SCRIPT FLUSH only support SYNC|ASYNC option")
+			}
+		}
+		scripts.flush()
+		return reply.MakeOkReply()
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + subCmd + "'. Try SCRIPT HELP.")
+}
+
+// 编译错误的回复
+func compileErrReply(err error) resp.Reply {
+	return reply.MakeErrReply("ERR Error compiling script (new function): " + oneLine(err.Error()))
+}
+
+// 错误回复中不能出现换行
+func oneLine(msg string) string {
+	return strings.Join(strings.Fields(msg), " ")
+}
+
+// 解析numkeys，返回KEYS和ARGV
+func parseScriptKeys(args [][]byte) ([][]byte, [][]byte, reply.ErrorReply) {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return nil, nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if numKeys < 0 {
+		return nil, nil, reply.MakeErrReply("ERR Number of keys can't be negative")
+	}
+	if numKeys > len(args)-1 {
+		return nil, nil, reply.MakeErrReply("ERR Number of keys can't be greater than number of args")
+	}
+	return args[1 : 1+numKeys], args[1+numKeys:], nil
+}
+
+// EVAL和EVALSHA把KEYS中声明的key都当作写key加锁
+func prepareEval(args [][]byte) ([]string, []string) {
+	keys, _, errReply := parseScriptKeys(args[1:])
+	if errReply != nil {
+		return nil, nil
+	}
+	writeKeys := make([]string, len(keys))
+	for i, key := range keys {
+		writeKeys[i] = string(key)
+	}
+	return writeKeys, nil
+}
+
+// 事务中的脚本回滚KEYS中声明的key
+func undoEval(db *DB, args [][]byte) []CmdLine {
+	writeKeys, _ := prepareEval(args)
+	return rollbackGivenKeys(db, writeKeys...)
+}
+
+// 执行脚本，调用者已经持有KEYS中所有key的锁
+func (db *DB) runScript(sha string, proto *lua.FunctionProto, args [][]byte) resp.Reply {
+	keys, argv, errReply := parseScriptKeys(args)
+	if errReply != nil {
+		return errReply
+	}
+	// 脚本中的写命令先暂存，脚本结束后作为一个事务写入aof，重放时和执行时一样是原子的
+	// 脚本出错时已经执行的写命令不会回滚，同样需要写入aof
+	var aofLines []CmdLine
+	scriptDB := *db
+	scriptDB.addAof = func(line CmdLine) {
+		aofLines = append(aofLines, line)
+	}
+	defer func() {
+		if len(aofLines) > 0 {
+			db.addAofMulti(aofLines)
+		}
+	}()
+	L := newScriptState(&scriptDB, keys)
+	defer L.Close()
+	L.SetGlobal("KEYS", bytesToTable(L, keys))
+	L.SetGlobal("ARGV", bytesToTable(L, argv))
+
+	L.Push(L.NewFunctionFromProto(proto))
+	if err := L.PCall(0, 1, nil); err != nil {
+		if apiErr, ok := err.(*lua.ApiError); ok {
+			// redis.call 抛出的错误原样返回给客户端
+			if tbl, ok := apiErr.Object.(*lua.LTable); ok {
+				if msg, ok := tbl.RawGetString("err").(lua.LString); ok {
+					return reply.MakeErrReply(string(msg))
+				}
+			}
+			return reply.MakeErrReply("ERR Error running script (call to f_" + sha + "): " + oneLine(apiErr.Object.String()))
+		}
+		return reply.MakeErrReply("ERR Error running script (call to f_" + sha + "): " + oneLine(err.Error()))
+	}
+	ret := L.Get(-1)
+	L.Pop(1)
+	return luaToReply(ret)
+}
+
+// 创建一个只包含安全标准库的Lua虚拟机，并注册redis表
+func newScriptState(db *DB, keys [][]byte) *lua.LState {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		fn   lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.fn))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	// 脚本不能访问文件系统
+	for _, name := range []string{"dofile", "loadfile", "require", "module"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+
+	declared := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		declared[string(key)] = true
+	}
+	redis := L.NewTable()
+	redis.RawSetString("call", L.NewFunction(func(L *lua.LState) int {
+		return scriptCall(L, db, declared, true)
+	}))
+	redis.RawSetString("pcall", L.NewFunction(func(L *lua.LState) int {
+		return scriptCall(L, db, declared, false)
+	}))
+	redis.RawSetString("error_reply", L.NewFunction(func(L *lua.LState) int {
+		tbl := L.NewTable()
+		tbl.RawSetString("err", lua.LString(L.CheckString(1)))
+		L.Push(tbl)
+		return 1
+	}))
+	redis.RawSetString("status_reply", L.NewFunction(func(L *lua.LState) int {
+		tbl := L.NewTable()
+		tbl.RawSetString("ok", lua.LString(L.CheckString(1)))
+		L.Push(tbl)
+		return 1
+	}))
+	redis.RawSetString("sha1hex", L.NewFunction(func(L *lua.LState) int {
+		L.Push(lua.LString(sha1hex(L.CheckString(1))))
+		return 1
+	}))
+	L.SetGlobal("redis", redis)
+	return L
+}
+
+// redis.call 和 redis.pcall 的实现
+// raise为true时，命令执行出错会抛出Lua错误，否则把错误作为返回值
+func scriptCall(L *lua.LState, db *DB, declared map[string]bool, raise bool) int {
+	n := L.GetTop()
+	if n == 0 {
+		return scriptError(L, "ERR Please specify at least one argument for this redis lib call", raise)
+	}
+	cmdLine := make([][]byte, n)
+	for i := 1; i <= n; i++ {
+		switch arg := L.Get(i).(type) {
+		case lua.LString:
+			cmdLine[i-1] = []byte(arg)
+		case lua.LNumber:
+			cmdLine[i-1] = []byte(arg.String())
+		default:
+			return scriptError(L, "ERR Lua redis lib command arguments must be strings or integers", raise)
+		}
+	}
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := lookupCommand(cmdName)
+	if !ok {
+		return scriptError(L, "ERR Unknown Redis command called from script", raise)
+	}
+	// 命令表中标记了 noscript 的命令不能在脚本中执行
+	if cmd.flags&flagNoScript != 0 {
+		return scriptError(L, "ERR This Redis command is not allowed from script", raise)
+	}
+	if !validateArity(cmd.arity, cmdLine) {
+		return scriptError(L, "ERR Wrong number of args calling Redis command from script", raise)
+	}
+	// 只有KEYS中声明的key加了锁，访问其他key会和其他客户端的命令并发执行
+	write, read := cmd.prepare(cmdLine[1:])
+	for _, keys := range [][]string{write, read} {
+		for _, key := range keys {
+			if !declared[key] {
+				return scriptError(L, "ERR Script attempted to access key '"+key+"' that was not declared in KEYS", raise)
+			}
+		}
+	}
+	if err := cmd.checkOOM(); err != nil {
+		return scriptError(L, errorReplyMsg(err), raise)
+	}
+	result := db.execWithLock(cmdLine)
+	if errReply, ok := result.(reply.ErrorReply); ok {
+		return scriptError(L, errorReplyMsg(errReply), raise)
+	}
+	L.Push(replyToLua(L, result))
+	return 1
+}
+
+// 构造错误表，根据raise决定抛出还是返回
+func scriptError(L *lua.LState, msg string, raise bool) int {
+	tbl := L.NewTable()
+	tbl.RawSetString("err", lua.LString(msg))
+	if raise {
+		L.Error(tbl, 1)
+		return 0
+	}
+	L.Push(tbl)
+	return 1
+}
+
+// 取出错误回复中的错误信息
+func errorReplyMsg(errReply resp.Reply) string {
+	msg := string(errReply.ToBytes())
+	msg = strings.TrimPrefix(msg, "-")
+	return strings.TrimSuffix(msg, reply.CRLF)
+}
+
+// 将字节数组切片转换成Lua数组
+func bytesToTable(L *lua.LState, args [][]byte) *lua.LTable {
+	tbl := L.CreateTable(len(args), 0)
+	for i, arg := range args {
+		tbl.RawSetInt(i+1, lua.LString(arg))
+	}
+	return tbl
+}
+
+// 将命令的回复转换成Lua值
+func replyToLua(L *lua.LState, r resp.Reply) lua.LValue {
+	switch val := r.(type) {
+	case *reply.IntReply:
+		return lua.LNumber(val.Code)
+	case *reply.BulkReply:
+		if val.Arg == nil {
+			return lua.LFalse
+		}
+		return lua.LString(val.Arg)
+	case *reply.NullBulkReply, reply.NullBulkReply, *reply.NullReply:
+		return lua.LFalse
+	case *reply.EmptyMultiBulkReply, reply.EmptyMultiBulkReply:
+		return L.NewTable()
+	// 脚本使用RESP2的语义，浮点数、大数和带格式的文本都是字符串
+	case *reply.DoubleReply:
+		return lua.LString(strconv.FormatFloat(val.Value, 'f', -1, 64))
+	case *reply.BigNumberReply:
+		return lua.LString(val.Value.String())
+	case *reply.VerbatimReply:
+		return lua.LString(val.Text)
+	case *reply.BooleanReply:
+		if val.Value {
+			return lua.LNumber(1)
+		}
+		return lua.LNumber(0)
+	case *reply.MultiBulkReply:
+		tbl := L.CreateTable(len(val.Args), 0)
+		for i, arg := range val.Args {
+			if arg == nil {
+				tbl.RawSetInt(i+1, lua.LFalse)
+			} else {
+				tbl.RawSetInt(i+1, lua.LString(arg))
+			}
+		}
+		return tbl
+	case *reply.MultiRawReply:
+		return repliesToTable(L, val.Replies)
+	case *reply.MapReply:
+		return repliesToTable(L, val.Args)
+	case *reply.SetReply:
+		return repliesToTable(L, val.Members)
+	case *reply.PushReply:
+		return repliesToTable(L, val.Args)
+	case reply.ErrorReply:
+		tbl := L.NewTable()
+		tbl.RawSetString("err", lua.LString(errorReplyMsg(val)))
+		return tbl
+	}
+	// 其余的都是状态回复，比如 +OK
+	tbl := L.NewTable()
+	status := strings.TrimSuffix(string(r.ToBytes()), reply.CRLF)
+	tbl.RawSetString("ok", lua.LString(strings.TrimPrefix(status, "+")))
+	return tbl
+}
+
+// 将多条回复转换成Lua数组
+func repliesToTable(L *lua.LState, replies []resp.Reply) *lua.LTable {
+	tbl := L.CreateTable(len(replies), 0)
+	for i, rep := range replies {
+		tbl.RawSetInt(i+1, replyToLua(L, rep))
+	}
+	return tbl
+}
+
+// 将脚本的返回值转换成回复
+func luaToReply(value lua.LValue) resp.Reply {
+	switch val := value.(type) {
+	case lua.LString:
+		return reply.MakeBulkReply([]byte(val))
+	case lua.LNumber:
+		// 和Redis一样，小数部分被截断
+		return reply.MakeIntReply(int64(val))
+	case lua.LBool:
+		if val {
+			return reply.MakeIntReply(1)
+		}
+		return reply.MakeNullBulkReply()
+	case *lua.LTable:
+		if msg, ok := val.RawGetString("err").(lua.LString); ok {
+			return reply.MakeErrReply(string(msg))
+		}
+		if status, ok := val.RawGetString("ok").(lua.LString); ok {
+			return reply.MakeStatusReply(string(status))
+		}
+		// 和Redis一样，数组在第一个nil处截断
+		replies := make([]resp.Reply, 0, val.Len())
+		for i := 1; ; i++ {
+			elem := val.RawGetInt(i)
+			if elem == lua.LNil {
+				break
+			}
+			replies = append(replies, luaToReply(elem))
+		}
+		return reply.MakeMultiRawReply(replies)
+	}
+	return reply.MakeNullBulkReply()
+}
+
+func init() {
+	// 执行Lua脚本
+	RegisterCommand("Eval", execEval, prepareEval, undoEval, -3).
+		attachInfo(flagNoScript|flagMovableKeys, 0, 0, 0, aclScripting)
+	// 根据sha1执行缓存中的Lua脚本
+	RegisterCommand("EvalSha", execEvalSha, prepareEval, undoEval, -3).
+		attachInfo(flagNoScript|flagMovableKeys, 0, 0, 0, aclScripting)
+	// 管理脚本缓存
+	RegisterCommand("Script", execScript, noPrepare, nil, -2).
+		attachInfo(flagNoScript, 0, 0, 0, aclScripting)
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"GoRedis/interface/resp"
+	"GoRedis/resp/connection"
+	"GoRedis/resp/reply"
+	"strconv"
+	"strings"
+)
+
+// RedisVersion 对客户端声明的Redis版本
+const RedisVersion = "6.2.0"
+
+// HELLO [protover [AUTH username password] [SETNAME clientname]]
+// 协商客户端使用的RESP协议版本
+func (Sdb *StandaloneDatabase) execHello(c resp.Connection, args [][]byte) resp.Reply {
+	protocol := c.GetProtocol()
+	name := c.GetName()
+	authenticated := false
+	if len(args) > 0 {
+		ver, err := strconv.Atoi(string(args[0]))
+		if err != nil {
+			return reply.MakeErrReply("ERR Protocol version is not an integer or out of range")
+		}
+		if ver != reply.Resp2 && ver != reply.Resp3 {
+			return reply.MakeErrReply("NOPROTO unsupported protocol version")
+		}
+		protocol = ver
+		for i := 1; i < len(args); i++ {
+			opt := strings.ToLower(string(args[i]))
+			if opt == "auth" && i+2 < len(args) {
+				if !Sdb.checkPassword(string(args[i+1]), string(args[i+2])) {
+					return reply.MakeErrReply("WRONGPASS invalid username-password pair or user is disabled.")
+				}
+				authenticated = true
+				i += 2
+				continue
+			}
+			if opt == "setname" && i+1 < len(args) {
+				name = string(args[i+1])
+				if !connection.IsValidName(name) {
+					return reply.MakeErrReply("ERR Client names cannot contain spaces, newlines or special characters.")
+				}
+				i++
+				continue
+			}
+			return reply.MakeErrReply("ERR Syntax error in HELLO option '" + opt + "'")
+		}
+	}
+	if authenticated {
+		c.SetAuthenticated(true)
+	} else if Sdb.password() != "" && !c.IsAuthenticated() {
+		return reply.MakeErrReply("NOAUTH HELLO must be called with the client already authenticated, " +
+			"otherwise the HELLO AUTH <user> <pass> option can be used to authenticate the client " +
+			"and select the RESP protocol version at the same time")
+	}
+	c.SetProtocol(protocol)
+	c.SetName(name)
+	return reply.MakeMapReply([]resp.Reply{
+		reply.MakeBulkReply([]byte("server")), reply.MakeBulkReply([]byte("redis")),
+		reply.MakeBulkReply([]byte("version")), reply.MakeBulkReply([]byte(RedisVersion)),
+		reply.MakeBulkReply([]byte("proto")), reply.MakeIntReply(int64(protocol)),
+		reply.MakeBulkReply([]byte("id")), reply.MakeIntReply(c.GetID()),
+		reply.MakeBulkReply([]byte("mode")), reply.MakeBulkReply([]byte("standalone")),
+		reply.MakeBulkReply([]byte("role")), reply.MakeBulkReply([]byte("master")),
+		reply.MakeBulkReply([]byte("modules")), reply.MakeMultiRawReply([]resp.Reply{}),
+	})
+}
@@ -55,6 +55,9 @@ func execSAdd(db *DB, args [][]byte) resp.Reply {
 		counter += set.Add(string(member))
 	}
 	db.addAof(utils.ToCmdLine2("sadd", args...))
+	if counter > 0 {
+		db.notify(notifySet, "sadd", key)
+	}
 	return reply.MakeIntReply(int64(counter))
 }
 
@@ -97,13 +100,15 @@ func execSRem(db *DB, args [][]byte) resp.Reply {
 		counter += set.Remove(string(member))
 	}
 
+	if counter > 0 {
+		db.addAof(utils.ToCmdLine2("srem", args...))
+		db.notify(notifySet, "srem", key)
+	}
+
 	// 集合中已经没有成员
 	if set.Len() == 0 {
 		db.Remove(key)
-	}
-
-	if counter > 0 {
-		db.addAof(utils.ToCmdLine2("srem", args...))
+		db.notify(notifyGeneric, "del", key)
 	}
 	return reply.MakeIntReply(int64(counter))
 }
@@ -143,7 +148,7 @@ func execSMembers(db *DB, args [][]byte) resp.Reply {
 		i++
 		return true
 	})
-	return reply.MakeMultiBulkReply(arr)
+	return makeMembersReply(arr)
 }
 
 // SINTER key1 [key2]
@@ -183,7 +188,7 @@ func execSInter(db *DB, args [][]byte) resp.Reply {
 		i++
 		return true
 	})
-	return reply.MakeMultiBulkReply(arr)
+	return makeMembersReply(arr)
 }
 
 // SUNION key1 [key2]
@@ -223,7 +228,7 @@ func execSUnion(db *DB, args [][]byte) resp.Reply {
 		i++
 		return true
 	})
-	return reply.MakeMultiBulkReply(arr)
+	return makeMembersReply(arr)
 }
 
 // SDIFF key1 [key2]
@@ -271,24 +276,41 @@ func execSDiff(db *DB, args [][]byte) resp.Reply {
 		i++
 		return true
 	})
-	return reply.MakeMultiBulkReply(arr)
+	return makeMembersReply(arr)
 }
 
 func init() {
 	// 插入一个成员
-	RegisterCommand("SAdd", execSAdd, writeFirstKey, undoSetChange, -3)
+	RegisterCommand("SAdd", execSAdd, writeFirstKey, undoSetChange, -3).
+		attachInfo(flagWrite|flagDenyOOM|flagFast, 1, 1, 1, aclSet)
 	// 判断给定参数是否是集合的成员
-	RegisterCommand("SIsMember", execSIsMember, readFirstKey, nil, 3)
+	RegisterCommand("SIsMember", execSIsMember, readFirstKey, nil, 3).
+		attachInfo(flagReadOnly|flagFast, 1, 1, 1, aclSet)
 	// 删除集合的一个或多个成员
-	RegisterCommand("SRem", execSRem, writeFirstKey, undoSetChange, -3)
+	RegisterCommand("SRem", execSRem, writeFirstKey, undoSetChange, -3).
+		attachInfo(flagWrite|flagFast, 1, 1, 1, aclSet)
 	// 返回集合的成员数量
-	RegisterCommand("SCard", execSCard, readFirstKey, nil, 2)
+	RegisterCommand("SCard", execSCard, readFirstKey, nil, 2).
+		attachInfo(flagReadOnly|flagFast, 1, 1, 1, aclSet)
 	// 返回集合的所有成员
-	RegisterCommand("SMembers", execSMembers, readFirstKey, nil, 2)
+	RegisterCommand("SMembers", execSMembers, readFirstKey, nil, 2).
+		attachInfo(flagReadOnly, 1, 1, 1, aclSet)
 	// 交集
-	RegisterCommand("SInter", execSInter, prepareSetCalculate, nil, -2)
+	RegisterCommand("SInter", execSInter, prepareSetCalculate, nil, -2).
+		attachInfo(flagReadOnly, 1, -1, 1, aclSet)
 	// 并集
-	RegisterCommand("SUnion", execSUnion, prepareSetCalculate, nil, -2)
+	RegisterCommand("SUnion", execSUnion, prepareSetCalculate, nil, -2).
+		attachInfo(flagReadOnly, 1, -1, 1, aclSet)
 	// 差集
-	RegisterCommand("SDiff", execSDiff, prepareSetCalculate, nil, -2)
+	RegisterCommand("SDiff", execSDiff, prepareSetCalculate, nil, -2).
+		attachInfo(flagReadOnly, 1, -1, 1, aclSet)
+}
+
+// 集合成员的回复，RESP3客户端收到的是set
+func makeMembersReply(members [][]byte) resp.Reply {
+	replies := make([]resp.Reply, len(members))
+	for i, member := range members {
+		replies[i] = reply.MakeBulkReply(member)
+	}
+	return reply.MakeSetReply(replies)
 }
@@ -0,0 +1,174 @@
+package database
+
+import (
+	"GoRedis/config"
+	"GoRedis/interface/resp"
+	"GoRedis/lib/logger"
+	"GoRedis/resp/reply"
+	"container/list"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ * 慢查询日志
+ * 执行时间超过 slowlog-log-slower-than 微秒的命令会被记录下来，最多保存 slowlog-max-len 条
+ */
+
+const (
+	// 每条日志最多记录的参数个数
+	slowlogMaxArgc = 32
+	// 每个参数最多记录的字节数
+	slowlogMaxArgLen = 128
+)
+
+// 一条慢查询日志
+type slowlogEntry struct {
+	id int64
+	// 命令开始执行的时间
+	time time.Time
+	// 执行时间
+	duration time.Duration
+	args     [][]byte
+	// 客户端的地址和名称
+	addr string
+	name string
+}
+
+// 慢查询日志，新的日志插入到链表头部，超过长度时删除尾部的旧日志
+type slowLog struct {
+	mu      sync.Mutex
+	entries *list.List
+	nextID  int64
+}
+
+func makeSlowLog() *slowLog {
+	return &slowLog{
+		entries: list.New(),
+	}
+}
+
+// 记录一条命令，执行时间没有超过阈值时不记录
+func (s *slowLog) record(c resp.Connection, cmdLine [][]byte, start time.Time, duration time.Duration) {
+	threshold := config.Properties().SlowlogLogSlowerThan
+	if threshold < 0 || duration < time.Duration(threshold)*time.Microsecond {
+		return
+	}
+	logger.With("addr", c.Addr(), "db", c.GetDBIndex(), "cmd", strings.ToLower(string(cmdLine[0])),
+		"duration_us", duration.Microseconds()).Verbose("slow command")
+	entry := &slowlogEntry{
+		time:     start,
+		duration: duration,
+		args:     truncateArgs(cmdLine),
+		addr:     c.Addr(),
+		name:     c.GetName(),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry.id = s.nextID
+	s.nextID++
+	s.entries.PushFront(entry)
+	s.trimLocked(config.Properties().SlowlogMaxLen)
+}
+
+// 删除超过 maxLen 的旧日志，用于修改 slowlog-max-len 之后
+func (s *slowLog) trim(maxLen int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.trimLocked(maxLen)
+}
+
+// 删除超过 maxLen 的旧日志，调用者需要持有锁
+func (s *slowLog) trimLocked(maxLen int) {
+	for s.entries.Len() > maxLen && s.entries.Len() > 0 {
+		s.entries.Remove(s.entries.Back())
+	}
+}
+
+// 截断过长的参数，和Redis一致
+func truncateArgs(cmdLine [][]byte) [][]byte {
+	argc := len(cmdLine)
+	if argc > slowlogMaxArgc {
+		argc = slowlogMaxArgc
+	}
+	args := make([][]byte, argc)
+	for i := 0; i < argc; i++ {
+		// 最后一个位置记录剩余参数的个数
+		if i == slowlogMaxArgc-1 && len(cmdLine) > slowlogMaxArgc {
+			args[i] = []byte("... (" + strconv.Itoa(len(cmdLine)-slowlogMaxArgc+1) + " more arguments)")
+			break
+		}
+		arg := cmdLine[i]
+		if len(arg) > slowlogMaxArgLen {
+			more := len(arg) - slowlogMaxArgLen
+			arg = append(arg[:slowlogMaxArgLen:slowlogMaxArgLen], []byte("... ("+strconv.Itoa(more)+" more bytes)")...)
+		} else {
+			arg = append([]byte(nil), arg...)
+		}
+		args[i] = arg
+	}
+	return args
+}
+
+// SLOWLOG GET [count] | LEN | RESET
+func (s *slowLog) exec(args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("slowlog")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "get":
+		if len(args) > 2 {
+			return reply.MakeArgNumErrReply("slowlog|get")
+		}
+		count := 10
+		if len(args) == 2 {
+			n, err := strconv.Atoi(string(args[1]))
+			if err != nil || n < -1 {
+				return reply.MakeErrReply("ERR count should be greater than or equal to -1")
+			}
+			count = n
+		}
+		return s.get(count)
+	case "len":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("slowlog|len")
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return reply.MakeIntReply(int64(s.entries.Len()))
+	case "reset":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("slowlog|reset")
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.entries.Init()
+		return reply.MakeOkReply()
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + subCmd + "'. Try SLOWLOG HELP.")
+}
+
+// 返回最新的count条日志，count为-1时返回全部
+func (s *slowLog) get(count int) resp.Reply {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if count == -1 || count > s.entries.Len() {
+		count = s.entries.Len()
+	}
+	result := make([]resp.Reply, 0, count)
+	for e := s.entries.Front(); e != nil && len(result) < count; e = e.Next() {
+		entry := e.Value.(*slowlogEntry)
+		result = append(result, reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeIntReply(entry.id),
+			reply.MakeIntReply(entry.time.Unix()),
+			reply.MakeIntReply(entry.duration.Microseconds()),
+			reply.MakeMultiBulkReply(entry.args),
+			reply.MakeBulkReply([]byte(entry.addr)),
+			reply.MakeBulkReply([]byte(entry.name)),
+		}))
+	}
+	return reply.MakeMultiRawReply(result)
+}
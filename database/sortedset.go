@@ -71,15 +71,23 @@ func execZAdd(db *DB, args [][]byte) resp.Reply {
 		return errReply
 	}
 
-	// 添加元素进sortedset
+	// 添加元素进sortedset，同时记录分数有变化的成员数量
 	i := 0
+	updated := 0
 	for _, e := range elements {
+		old, exists := sortedSet.Get(e.Member)
 		if sortedSet.Add(e.Member, e.Score) {
 			i++
+		} else if exists && old.Score != e.Score {
+			updated++
 		}
 	}
 
 	db.addAof(utils.ToCmdLine2("zadd", args...))
+	// 和Redis一致，只有添加了成员或者修改了分数时才发送事件
+	if i+updated > 0 {
+		db.notify(notifyZSet, "zadd", key)
+	}
 	return reply.MakeIntReply(int64(i))
 }
 
@@ -103,9 +111,8 @@ func execZScore(db *DB, args [][]byte) resp.Reply {
 	if !exists {
 		return &reply.NullBulkReply{}
 	}
-	// 转换分数
-	value := strconv.FormatFloat(element.Score, 'f', -1, 64)
-	return reply.MakeBulkReply([]byte(value))
+	// RESP3客户端收到的是double
+	return reply.MakeDoubleReply(element.Score)
 }
 
 // ZRANK key member
@@ -291,6 +298,7 @@ func execZRem(db *DB, args [][]byte) resp.Reply {
 	}
 	if deleted > 0 {
 		db.addAof(utils.ToCmdLine2("zrem", args...))
+		db.notify(notifyZSet, "zrem", key)
 	}
 	return reply.MakeIntReply(deleted)
 }
@@ -326,6 +334,7 @@ func execZRemRangeByScore(db *DB, args [][]byte) resp.Reply {
 	removed := sortedSet.RemoveByScore(min, max)
 	if removed > 0 {
 		db.addAof(utils.ToCmdLine2("zremrangebyscore", args...))
+		db.notify(notifyZSet, "zremrangebyscore", key)
 	}
 	return reply.MakeIntReply(removed)
 }
@@ -380,6 +389,7 @@ func execZRemRangeByRank(db *DB, args [][]byte) resp.Reply {
 	removed := sortedSet.RemoveByRank(start, stop)
 	if removed > 0 {
 		db.addAof(utils.ToCmdLine2("zremrangebyrank", args...))
+		db.notify(notifyZSet, "zremrangebyrank", key)
 	}
 	return reply.MakeIntReply(removed)
 }
@@ -411,21 +421,30 @@ func undoZRem(db *DB, args [][]byte) []CmdLine {
 }
 func init() {
 	// 插入一个成员
-	RegisterCommand("ZAdd", execZAdd, writeFirstKey, undoZAdd, -4)
+	RegisterCommand("ZAdd", execZAdd, writeFirstKey, undoZAdd, -4).
+		attachInfo(flagWrite|flagDenyOOM|flagFast, 1, 1, 1, aclSortedSet)
 	// 返回成员的分数值
-	RegisterCommand("ZScore", execZScore, readFirstKey, nil, 3)
+	RegisterCommand("ZScore", execZScore, readFirstKey, nil, 3).
+		attachInfo(flagReadOnly|flagFast, 1, 1, 1, aclSortedSet)
 	// 返回成员的排名
-	RegisterCommand("ZRank", execZRank, readFirstKey, nil, 3)
+	RegisterCommand("ZRank", execZRank, readFirstKey, nil, 3).
+		attachInfo(flagReadOnly|flagFast, 1, 1, 1, aclSortedSet)
 	// 返回处于给定分数区间的成员数
-	RegisterCommand("ZCount", execZCount, readFirstKey, nil, 4)
+	RegisterCommand("ZCount", execZCount, readFirstKey, nil, 4).
+		attachInfo(flagReadOnly|flagFast, 1, 1, 1, aclSortedSet)
 	// 返回集合的所有成员
-	RegisterCommand("ZCard", execZCard, readFirstKey, nil, 2)
+	RegisterCommand("ZCard", execZCard, readFirstKey, nil, 2).
+		attachInfo(flagReadOnly|flagFast, 1, 1, 1, aclSortedSet)
 	// 通过索引区间返回指定区间内的成员
-	RegisterCommand("ZRange", execZRange, readFirstKey, nil, -4)
+	RegisterCommand("ZRange", execZRange, readFirstKey, nil, -4).
+		attachInfo(flagReadOnly, 1, 1, 1, aclSortedSet)
 	// 移除有序集合中的一个或多个成员
-	RegisterCommand("ZRem", execZRem, writeFirstKey, undoZRem, -3)
+	RegisterCommand("ZRem", execZRem, writeFirstKey, undoZRem, -3).
+		attachInfo(flagWrite|flagFast, 1, 1, 1, aclSortedSet)
 	// 移除有序集合中给定的分数区间的所有成员
-	RegisterCommand("ZRemRangeByScore", execZRemRangeByScore, writeFirstKey, rollbackFirstKey, 4)
+	RegisterCommand("ZRemRangeByScore", execZRemRangeByScore, writeFirstKey, rollbackFirstKey, 4).
+		attachInfo(flagWrite, 1, 1, 1, aclSortedSet)
 	// 移除有序集合中给定的排名区间的所有成员
-	RegisterCommand("ZRemRangeByRank", execZRemRangeByRank, writeFirstKey, rollbackFirstKey, 4)
+	RegisterCommand("ZRemRangeByRank", execZRemRangeByRank, writeFirstKey, rollbackFirstKey, 4).
+		attachInfo(flagWrite, 1, 1, 1, aclSortedSet)
 }
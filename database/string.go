@@ -25,6 +25,7 @@ func execSet(db *DB, args [][]byte) resp.Reply {
 	entity := &database.DataEntity{Data: value}
 	db.PutEntity(key, entity)
 	db.addAof(utils.ToCmdLine2("set", args...))
+	db.notify(notifyString, "set", key)
 	return reply.MakeOkReply()
 }
 
@@ -35,6 +36,9 @@ func execSetnx(db *DB, args [][]byte) resp.Reply {
 	entity := &database.DataEntity{Data: value}
 	result := db.PutIfAbsent(key, entity)
 	db.addAof(utils.ToCmdLine2("setnx", args...))
+	if result > 0 {
+		db.notify(notifyString, "set", key)
+	}
 	return reply.MakeIntReply(int64(result))
 }
 
@@ -44,6 +48,7 @@ func execGetSet(db *DB, args [][]byte) resp.Reply {
 	value := args[1]
 	entity, exists := db.GetEntity(key)
 	db.PutEntity(key, &database.DataEntity{Data: value})
+	db.notify(notifyString, "set", key)
 	if !exists {
 		return reply.MakeNullBulkReply()
 	}
@@ -63,9 +68,14 @@ func execStrLen(db *DB, args [][]byte) resp.Reply {
 }
 
 func init() {
-	RegisterCommand("Get", execGet, readFirstKey, nil, 2)
-	RegisterCommand("Set", execSet, writeFirstKey, rollbackFirstKey, 3)
-	RegisterCommand("SetNx", execSetnx, writeFirstKey, rollbackFirstKey, 3)
-	RegisterCommand("GetSet", execGetSet, writeFirstKey, rollbackFirstKey, 3)
-	RegisterCommand("StrLen", execStrLen, readFirstKey, nil, 2)
+	RegisterCommand("Get", execGet, readFirstKey, nil, 2).
+		attachInfo(flagReadOnly|flagFast, 1, 1, 1, aclString)
+	RegisterCommand("Set", execSet, writeFirstKey, rollbackFirstKey, 3).
+		attachInfo(flagWrite|flagDenyOOM, 1, 1, 1, aclString)
+	RegisterCommand("SetNx", execSetnx, writeFirstKey, rollbackFirstKey, 3).
+		attachInfo(flagWrite|flagDenyOOM|flagFast, 1, 1, 1, aclString)
+	RegisterCommand("GetSet", execGetSet, writeFirstKey, rollbackFirstKey, 3).
+		attachInfo(flagWrite|flagDenyOOM|flagFast, 1, 1, 1, aclString)
+	RegisterCommand("StrLen", execStrLen, readFirstKey, nil, 2).
+		attachInfo(flagReadOnly|flagFast, 1, 1, 1, aclString)
 }
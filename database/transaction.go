@@ -26,7 +26,8 @@ func execGetVersion(db *DB, args [][]byte) resp.Reply {
 }
 
 func init() {
-	RegisterCommand("GetVer", execGetVersion, readAllKeys, nil, 2)
+	RegisterCommand("GetVer", execGetVersion, readAllKeys, nil, 2).
+		attachInfo(flagReadOnly|flagFast, 1, 1, 1, aclKeyspace)
 }
 
 // 判断正在监视的key版本号有没有发生变化
@@ -75,6 +76,12 @@ func EnqueueCmd(conn resp.Connection, cmdLine [][]byte) resp.Reply {
 		conn.AddTxError(err)
 		return err
 	}
+	// 内存超过限制时拒绝可能占用更多内存的命令
+	if err := cmd.checkOOM(); err != nil {
+		cmd.stats.reject()
+		conn.AddTxError(err)
+		return err
+	}
 	// 将命令正式入队
 	conn.EnqueueCmd(cmdLine)
 	// 向客户端回复命令已入队
@@ -120,6 +127,20 @@ func (db *DB) ExecMulti(conn resp.Connection, watching map[string]uint32, cmdLin
 		watchingKeys = append(watchingKeys, key)
 	}
 
+	readKeys = append(readKeys, watchingKeys...)
+	var events []keyspaceEvent
+	result := func() resp.Reply {
+		db.locker.RWLocks(writeKeys, readKeys)
+		defer db.locker.RWUnLocks(writeKeys, readKeys)
+		return db.deferNotify(&events).execQueued(watching, cmdLines, writeKeys)
+	}()
+	// 释放锁之后再发送键空间通知
+	db.publishEvents(events)
+	return result
+}
+
+// 执行事务队列中的命令，调用者已经持有所有key的锁
+func (db *DB) execQueued(watching map[string]uint32, cmdLines []CmdLine, writeKeys []string) resp.Reply {
 	// 判断在事务中监视的key，现在的版本号有没有发生变化
 	// 如果版本号有变化，直接结束事务
 	if isWatchingChanged(db, watching) {
@@ -132,8 +153,8 @@ func (db *DB) ExecMulti(conn resp.Connection, watching map[string]uint32, cmdLin
 	for _, cmdLine := range cmdLines {
 		// 获取命令的回滚函数
 		undoCmdLines = append(undoCmdLines, db.GetUndoLogs(cmdLine))
-		// 执行命令
-		result := db.NormalExec(cmdLine)
+		// 执行命令，锁已经在前面加好了
+		result := db.execWithLock(cmdLine)
 		// 执行的过程中出现了错误
 		if reply.IsErrorReply(result) {
 			// 做个标记
@@ -159,7 +180,7 @@ func (db *DB) ExecMulti(conn resp.Connection, watching map[string]uint32, cmdLin
 			continue
 		}
 		for _, cmdLine := range curCmdLines {
-			db.NormalExec(cmdLine)
+			db.execWithLock(cmdLine)
 		}
 	}
 	return reply.MakeErrReply("EXECABORT Transaction discarded because of previous errors.")
@@ -1,3 +1,5 @@
 module GoRedis
 
 go 1.17
+
+require github.com/yuin/gopher-lua v1.1.1
@@ -10,7 +10,11 @@ type CmdLine = [][]byte
 // Database 是Redis的业务核心
 type Database interface {
 	Exec(client resp.Connection, args [][]byte) resp.Reply
+	// CheckAuth 检查客户端能否执行命令，需要认证时返回错误回复，用于不经过 Exec 的命令
+	CheckAuth(client resp.Connection, cmdName string) resp.Reply
 	AfterClientClose(c resp.Connection)
+	// PrepareShutdown 关闭前持久化数据，save 为 true 时还需要生成快照
+	PrepareShutdown(save bool) error
 	Close()
 }
 
@@ -8,6 +8,26 @@ type Connection interface {
 	GetDBIndex() int
 	// SelectDB 切换数据库
 	SelectDB(int)
+	// GetProtocol 客户端使用的RESP协议版本
+	GetProtocol() int
+	// SetProtocol 设置客户端使用的RESP协议版本
+	SetProtocol(int)
+	// GetID 客户端的唯一ID
+	GetID() int64
+	// Addr 客户端的地址
+	Addr() string
+	// GetName 客户端的名称
+	GetName() string
+	// SetName 设置客户端的名称
+	SetName(string)
+	// SetMonitor 将客户端切换为监视器
+	SetMonitor()
+	// IsMonitor 判断客户端是否执行了 MONITOR
+	IsMonitor() bool
+	// IsAuthenticated 判断客户端是否通过了认证
+	IsAuthenticated() bool
+	// SetAuthenticated 设置客户端的认证状态
+	SetAuthenticated(bool)
 
 	/*
 	 *	事务相关
@@ -36,8 +56,14 @@ type Connection interface {
 	Subscribe(channel string)
 	// UnSubscribe 退订频道
 	UnSubscribe(channel string)
-	// SubsCount 返回频道的订阅者数量
+	// SubsCount 返回订阅的频道和模式的总数
 	SubsCount() int
 	// GetChannels 获取所有频道
 	GetChannels() []string
+	// PSubscribe 订阅模式
+	PSubscribe(pattern string)
+	// PUnSubscribe 退订模式
+	PUnSubscribe(pattern string)
+	// GetPatterns 获取所有模式
+	GetPatterns() []string
 }
@@ -9,4 +9,6 @@ import (
 type Handler interface {
 	Handle(ctx context.Context, conn net.Conn)
 	Close() error
+	// Done 处理程序主动关闭时，返回的通道会被关闭
+	Done() <-chan struct{}
 }
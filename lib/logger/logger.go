@@ -1,13 +1,15 @@
 package logger
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"log"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -17,17 +19,34 @@ type Settings struct {
 	Name       string `yaml:"name"`
 	Ext        string `yaml:"ext"`
 	TimeFormat string `yaml:"time-format"`
+	// 日志级别 debug、verbose、notice、warning，为空时使用 notice
+	Level string `yaml:"level"`
+	// 单个日志文件的最大字节数，超过之后轮转，0表示不限制
+	MaxSize int64 `yaml:"max-size"`
+	// 保留的旧日志文件数量，0表示全部保留
+	MaxBackups int `yaml:"max-backups"`
+	// 使用JSON格式输出，每行一个对象
+	JSON bool `yaml:"json"`
+	// 是否同时写入syslog
+	Syslog bool `yaml:"syslog"`
+	// syslog 中的程序名和设施，设施为 user 或 local0 到 local7
+	SyslogIdent    string `yaml:"syslog-ident"`
+	SyslogFacility string `yaml:"syslog-facility"`
 }
 
 var (
-	logFile            *os.File
-	defaultPrefix      = ""
 	defaultCallerDepth = 2
-	// Logger 表示一个活动的日志对象，可以在多协程环境中写日志
-	logger     *log.Logger
-	mu         sync.Mutex
-	logPrefix  = ""
-	levelFlags = []string{"DEBUG", "INFO", "WARN", "ERROR", "FATAL"}
+	// 保证多个协程写日志时每一行是完整的
+	mu sync.Mutex
+	// 日志文件，没有调用 Setup 时只输出到标准输出
+	logFile *rotateFile
+	// syslog，没有开启时为nil
+	sysLog syslogWriter
+	// 是否使用JSON格式，和 logFile、sysLog 一样由 mu 保护
+	jsonFormat bool
+	// 低于这个级别的日志不输出，保存 logLevel
+	minLevel   = int32(INFO)
+	levelFlags = []string{"DEBUG", "VERBOSE", "INFO", "WARN", "ERROR", "FATAL"}
 )
 
 type logLevel int
@@ -35,96 +54,228 @@ type logLevel int
 // 日志级别
 const (
 	DEBUG logLevel = iota
+	VERBOSE
 	INFO
 	WARNING
 	ERROR
 	FATAL
 )
 
-const flags = log.LstdFlags
-
-func init() {
-	logger = log.New(os.Stdout, defaultPrefix, flags)
+// 配置中的级别名称，和Redis一致，ERROR 和 FATAL 总是输出
+var levelNames = map[string]logLevel{
+	"debug":   DEBUG,
+	"verbose": VERBOSE,
+	"notice":  INFO,
+	"warning": WARNING,
 }
 
-// Setup 初始化日志文件以及一个日志活动对象
+// Setup 初始化日志文件、日志级别和syslog
 func Setup(settings *Settings) {
-	var err error
-	dir := settings.Path
-	// 生成日志文件的名称
-	fileName := fmt.Sprintf("%s-%s.%s",
-		settings.Name,
-		time.Now().Format(settings.TimeFormat),
-		settings.Ext)
-
-	// 打开日志文件并返回文件描述符
-	logFile, err := mustOpen(fileName, dir)
+	if settings.Level != "" {
+		if err := SetLevel(settings.Level); err != nil {
+			fmt.Fprintln(os.Stderr, "logging.Setup err: "+err.Error())
+			os.Exit(1)
+		}
+	}
+	// 打开日志文件
+	file, err := openRotateFile(settings)
 	if err != nil {
-		log.Fatalf("logging.Setup err: %s", err)
+		fmt.Fprintln(os.Stderr, "logging.Setup err: "+err.Error())
+		os.Exit(1)
 	}
+	var sys syslogWriter
+	if settings.Syslog {
+		// 连接不上syslog时只写日志文件
+		sys, err = openSyslog(settings.SyslogIdent, settings.SyslogFacility)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "logging.Setup: can't open syslog: "+err.Error())
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	logFile = file
+	sysLog = sys
+	jsonFormat = settings.JSON
+}
+
+// SetLevel 修改日志级别，级别名称和Redis的 loglevel 一致
+func SetLevel(name string) error {
+	level, ok := levelNames[strings.ToLower(name)]
+	if !ok {
+		return errors.New("invalid log level: " + name)
+	}
+	atomic.StoreInt32(&minLevel, int32(level))
+	return nil
+}
+
+// Reopen 重新打开日志文件，用于 logrotate 移走日志文件之后
+func Reopen() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if logFile == nil {
+		return nil
+	}
+	return logFile.reopen()
+}
 
-	mw := io.MultiWriter(os.Stdout, logFile)
-	logger = log.New(mw, defaultPrefix, flags)
+// Entry 带有结构化字段的日志，比如客户端地址、数据库和命令
+// 文本格式中字段以 key=value 的形式追加在消息后面，JSON格式中作为对象的字段
+type Entry struct {
+	fields []interface{}
 }
 
-// 设置日志前缀
-func setPrefix(level logLevel) {
+// With 创建带有字段的日志，参数中字段名和值交替排列
+func With(fields ...interface{}) *Entry {
+	return &Entry{fields: fields}
+}
+
+// 输出一条日志
+func output(level logLevel, fields []interface{}, v ...interface{}) {
+	if level < logLevel(atomic.LoadInt32(&minLevel)) && level < ERROR {
+		return
+	}
 	// runtime.Caller函数传入一个参数
 	//skip=0：Caller()会报告Caller()的调用者的信息
 	//skip=1：Caller()会报告Caller()的调用者的调用者的信息
 	//skip=2：...
+	caller := ""
+	if _, file, line, ok := runtime.Caller(defaultCallerDepth); ok {
+		caller = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
+	msg := strings.TrimSuffix(fmt.Sprintln(v...), "\n")
+	now := time.Now()
 
-	// runtime.Caller函数返回4个参数
-	// pc：调用栈标识符
-	// file：带路径的完整文件名
-	// line：该调用在文件中的行号
-	// ok：是否可以获得信息
-	_, file, line, ok := runtime.Caller(defaultCallerDepth)
-	if ok {
-		logPrefix = fmt.Sprintf("[%s][%s:%d] ", levelFlags[level], filepath.Base(file), line)
+	// 日志格式和输出位置可能正在被 Setup 修改，都在锁内读取
+	mu.Lock()
+	defer mu.Unlock()
+	var line string
+	if jsonFormat {
+		line = formatJSON(now, level, caller, msg, fields)
 	} else {
-		logPrefix = fmt.Sprintf("[%s] ", levelFlags[level])
+		line = formatText(now, level, caller, msg, fields)
+	}
+	_, _ = os.Stdout.WriteString(line)
+	if logFile != nil {
+		if _, err := logFile.Write([]byte(line)); err != nil {
+			fmt.Fprintln(os.Stderr, "write log file: "+err.Error())
+		}
 	}
+	if sysLog != nil {
+		sysLog.write(level, formatText(time.Time{}, level, caller, msg, fields))
+	}
+}
+
+// 文本格式：[INFO][server.go:63] 2006/01/02 15:04:05 消息 key=value
+// 时间为零值时不输出时间，用于syslog
+func formatText(now time.Time, level logLevel, caller string, msg string, fields []interface{}) string {
+	var b strings.Builder
+	b.WriteString("[" + levelFlags[level] + "]")
+	if caller != "" {
+		b.WriteString("[" + caller + "]")
+	}
+	b.WriteByte(' ')
+	if !now.IsZero() {
+		b.WriteString(now.Format("2006/01/02 15:04:05") + " ")
+	}
+	b.WriteString(msg)
+	for i := 0; i < len(fields); i += 2 {
+		b.WriteString(" " + fmt.Sprint(fields[i]) + "=")
+		if i+1 < len(fields) {
+			value := fmt.Sprint(fields[i+1])
+			if value == "" || strings.ContainsAny(value, " \"=") {
+				value = fmt.Sprintf("%q", value)
+			}
+			b.WriteString(value)
+		}
+	}
+	b.WriteByte('\n')
+	return b.String()
+}
 
-	logger.SetPrefix(logPrefix)
+// JSON格式：{"time":...,"level":"info","caller":"server.go:63","msg":...,字段...}
+func formatJSON(now time.Time, level logLevel, caller string, msg string, fields []interface{}) string {
+	var b strings.Builder
+	writeField := func(key string, value interface{}) {
+		k, _ := json.Marshal(key)
+		v, err := json.Marshal(value)
+		if err != nil {
+			v, _ = json.Marshal(fmt.Sprint(value))
+		}
+		b.WriteByte(',')
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteString(`{"time":"` + now.Format(time.RFC3339Nano) + `"`)
+	writeField("level", strings.ToLower(levelFlags[level]))
+	if caller != "" {
+		writeField("caller", caller)
+	}
+	writeField("msg", msg)
+	for i := 0; i+1 < len(fields); i += 2 {
+		value := fields[i+1]
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		writeField(fmt.Sprint(fields[i]), value)
+	}
+	b.WriteString("}\n")
+	return b.String()
 }
 
 // Debug 打印Debug日志
 func Debug(v ...interface{}) {
-	mu.Lock()
-	defer mu.Unlock()
-	setPrefix(DEBUG)
-	logger.Println(v...)
+	output(DEBUG, nil, v...)
+}
+
+// Verbose 打印比较详细的日志，比如客户端的连接和断开
+func Verbose(v ...interface{}) {
+	output(VERBOSE, nil, v...)
 }
 
 // Info 打印常规日志
 func Info(v ...interface{}) {
-	mu.Lock()
-	defer mu.Unlock()
-	setPrefix(INFO)
-	logger.Println(v...)
+	output(INFO, nil, v...)
 }
 
 // Warn 打印警告日志
 func Warn(v ...interface{}) {
-	mu.Lock()
-	defer mu.Unlock()
-	setPrefix(WARNING)
-	logger.Println(v...)
+	output(WARNING, nil, v...)
 }
 
 // Error 打印错误日志
 func Error(v ...interface{}) {
-	mu.Lock()
-	defer mu.Unlock()
-	setPrefix(ERROR)
-	logger.Println(v...)
+	output(ERROR, nil, v...)
 }
 
 // Fatal 打印错误日志并停止程序
 func Fatal(v ...interface{}) {
-	mu.Lock()
-	defer mu.Unlock()
-	setPrefix(FATAL)
-	logger.Fatalln(v...)
+	output(FATAL, nil, v...)
+	os.Exit(1)
+}
+
+// Debug 打印Debug日志
+func (e *Entry) Debug(v ...interface{}) {
+	output(DEBUG, e.fields, v...)
+}
+
+// Verbose 打印比较详细的日志
+func (e *Entry) Verbose(v ...interface{}) {
+	output(VERBOSE, e.fields, v...)
+}
+
+// Info 打印常规日志
+func (e *Entry) Info(v ...interface{}) {
+	output(INFO, e.fields, v...)
+}
+
+// Warn 打印警告日志
+func (e *Entry) Warn(v ...interface{}) {
+	output(WARNING, e.fields, v...)
+}
+
+// Error 打印错误日志
+func (e *Entry) Error(v ...interface{}) {
+	output(ERROR, e.fields, v...)
 }
@@ -0,0 +1,144 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// rotateFile 按日期命名的日志文件，日期变化或者超过最大字节数时轮转
+// 当前的文件名是 Name-日期.Ext，按大小轮转出的旧文件是 Name-日期.N.Ext
+type rotateFile struct {
+	dir        string
+	name       string
+	ext        string
+	timeFormat string
+	maxSize    int64
+	maxBackups int
+
+	file *os.File
+	// 当前文件的字节数
+	size int64
+	// 当前文件名中的日期
+	date string
+}
+
+func openRotateFile(settings *Settings) (*rotateFile, error) {
+	r := &rotateFile{
+		dir:        settings.Path,
+		name:       settings.Name,
+		ext:        settings.Ext,
+		timeFormat: settings.TimeFormat,
+		maxSize:    settings.MaxSize,
+		maxBackups: settings.MaxBackups,
+	}
+	if err := r.open(time.Now().Format(r.timeFormat)); err != nil {
+		return nil, err
+	}
+	r.removeOldFiles()
+	return r, nil
+}
+
+func (r *rotateFile) fileName(date string) string {
+	return fmt.Sprintf("%s-%s.%s", r.name, date, r.ext)
+}
+
+// 打开某个日期的日志文件
+func (r *rotateFile) open(date string) error {
+	f, err := mustOpen(r.fileName(date), r.dir)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	r.file = f
+	r.size = info.Size()
+	r.date = date
+	return nil
+}
+
+// 重新打开当前的日志文件
+func (r *rotateFile) reopen() error {
+	_ = r.file.Close()
+	return r.open(r.date)
+}
+
+func (r *rotateFile) Write(p []byte) (int, error) {
+	if date := time.Now().Format(r.timeFormat); date != r.date {
+		// 日期变化之后写入新的文件
+		_ = r.file.Close()
+		if err := r.open(date); err != nil {
+			return 0, err
+		}
+		r.removeOldFiles()
+	} else if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// 将当前文件重命名为编号最大的旧文件，然后打开新的文件
+func (r *rotateFile) rotate() error {
+	_ = r.file.Close()
+	current := filepath.Join(r.dir, r.fileName(r.date))
+	for i := 1; ; i++ {
+		backup := filepath.Join(r.dir, fmt.Sprintf("%s-%s.%d.%s", r.name, r.date, i, r.ext))
+		if _, err := os.Stat(backup); os.IsNotExist(err) {
+			if err := os.Rename(current, backup); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	if err := r.open(r.date); err != nil {
+		return err
+	}
+	r.removeOldFiles()
+	return nil
+}
+
+// 只保留最新的 maxBackups 个旧文件
+func (r *rotateFile) removeOldFiles() {
+	if r.maxBackups <= 0 {
+		return
+	}
+	matches, err := filepath.Glob(filepath.Join(r.dir, r.name+"-*."+r.ext))
+	if err != nil {
+		return
+	}
+	current := r.fileName(r.date)
+	type oldFile struct {
+		path    string
+		modTime time.Time
+	}
+	files := make([]oldFile, 0, len(matches))
+	for _, path := range matches {
+		if filepath.Base(path) == current || !strings.HasSuffix(path, "."+r.ext) {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		files = append(files, oldFile{path: path, modTime: info.ModTime()})
+	}
+	if len(files) <= r.maxBackups {
+		return
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.After(files[j].modTime)
+	})
+	for _, f := range files[r.maxBackups:] {
+		_ = os.Remove(f.path)
+	}
+}
@@ -0,0 +1,64 @@
+//go:build !windows && !plan9
+
+package logger
+
+import (
+	"errors"
+	"log/syslog"
+	"strings"
+)
+
+// 日志写入syslog
+type syslogWriter interface {
+	write(level logLevel, msg string)
+}
+
+var syslogFacilities = map[string]syslog.Priority{
+	"user":   syslog.LOG_USER,
+	"local0": syslog.LOG_LOCAL0,
+	"local1": syslog.LOG_LOCAL1,
+	"local2": syslog.LOG_LOCAL2,
+	"local3": syslog.LOG_LOCAL3,
+	"local4": syslog.LOG_LOCAL4,
+	"local5": syslog.LOG_LOCAL5,
+	"local6": syslog.LOG_LOCAL6,
+	"local7": syslog.LOG_LOCAL7,
+}
+
+type systemLog struct {
+	w *syslog.Writer
+}
+
+// 连接本机的syslog，facility 为空时使用 local0
+func openSyslog(ident string, facility string) (syslogWriter, error) {
+	if facility == "" {
+		facility = "local0"
+	}
+	priority, ok := syslogFacilities[strings.ToLower(facility)]
+	if !ok {
+		return nil, errors.New("invalid syslog facility: " + facility)
+	}
+	w, err := syslog.New(priority|syslog.LOG_NOTICE, ident)
+	if err != nil {
+		return nil, err
+	}
+	return &systemLog{w: w}, nil
+}
+
+// 按照日志级别选择syslog的优先级
+func (s *systemLog) write(level logLevel, msg string) {
+	switch level {
+	case DEBUG:
+		_ = s.w.Debug(msg)
+	case VERBOSE:
+		_ = s.w.Info(msg)
+	case INFO:
+		_ = s.w.Notice(msg)
+	case WARNING:
+		_ = s.w.Warning(msg)
+	case ERROR:
+		_ = s.w.Err(msg)
+	default:
+		_ = s.w.Crit(msg)
+	}
+}
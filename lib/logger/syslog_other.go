@@ -0,0 +1,15 @@
+//go:build windows || plan9
+
+package logger
+
+import "errors"
+
+// 日志写入syslog
+type syslogWriter interface {
+	write(level logLevel, msg string)
+}
+
+// 当前系统不支持syslog
+func openSyslog(ident string, facility string) (syslogWriter, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+)
+
+/*
+ * Prometheus 文本格式的指标
+ * https://prometheus.io/docs/instrumenting/exposition_formats/
+ */
+
+// 指标类型
+const (
+	Counter   = "counter"
+	Gauge     = "gauge"
+	Histogram = "histogram"
+)
+
+// Collector 将指标写入 Writer
+type Collector interface {
+	Collect(w *Writer)
+}
+
+// Writer 按照 Prometheus 文本格式输出指标
+// 同一个指标的样本需要连续输出，先调用 Family 输出说明和类型，再调用 Sample 输出样本
+type Writer struct {
+	buf bytes.Buffer
+}
+
+// Family 输出指标的说明和类型
+func (w *Writer) Family(name string, typ string, help string) {
+	w.buf.WriteString("# HELP " + name + " " + escapeHelp(help) + "\n")
+	w.buf.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+// Sample 输出一个样本，labels 中标签名和标签值交替排列
+func (w *Writer) Sample(name string, value float64, labels ...string) {
+	w.buf.WriteString(name)
+	if len(labels) > 0 {
+		w.buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			w.buf.WriteString(labels[i] + "=\"" + escapeLabel(labels[i+1]) + "\"")
+		}
+		w.buf.WriteByte('}')
+	}
+	w.buf.WriteByte(' ')
+	w.buf.WriteString(FormatFloat(value))
+	w.buf.WriteByte('\n')
+}
+
+// Single 输出只有一个样本并且没有标签的指标
+func (w *Writer) Single(name string, typ string, help string, value float64) {
+	w.Family(name, typ, help)
+	w.Sample(name, value)
+}
+
+// Bytes 返回已经输出的内容
+func (w *Writer) Bytes() []byte {
+	return w.buf.Bytes()
+}
+
+// FormatFloat 按照 Prometheus 的格式输出浮点数
+func FormatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer("\\", "\\\\", "\n", "\\n")
+	labelEscaper = strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\"", "\\\"")
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"GoRedis/lib/logger"
+	"net"
+	"net/http"
+	"time"
+)
+
+// 文本格式的 Content-Type
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Server 通过HTTP提供指标
+type Server struct {
+	listener net.Listener
+	server   *http.Server
+}
+
+// Listen 监听地址并在 /metrics 上提供 collector 收集的指标
+// 监听失败时返回错误，请求在单独的协程中处理
+func Listen(address string, collector Collector) (*Server, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(rw http.ResponseWriter, r *http.Request) {
+		var w Writer
+		collector.Collect(&w)
+		rw.Header().Set("Content-Type", contentType)
+		_, _ = rw.Write(w.Bytes())
+	})
+	s := &Server{
+		listener: listener,
+		server: &http.Server{
+			Handler:      mux,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		},
+	}
+	logger.Info("start listen metrics " + address)
+	go func() {
+		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logger.Error("metrics server: " + err.Error())
+		}
+	}()
+	return s, nil
+}
+
+// Close 关闭监听
+func (s *Server) Close() error {
+	return s.server.Close()
+}
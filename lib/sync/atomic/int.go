@@ -0,0 +1,21 @@
+package atomic
+
+import "sync/atomic"
+
+// Int64 是一个int64类型的变量，所有的动作都是原子性的
+type Int64 int64
+
+// Get 原子性地读取值
+func (i *Int64) Get() int64 {
+	return atomic.LoadInt64((*int64)(i))
+}
+
+// Set 原子性地写入值
+func (i *Int64) Set(v int64) {
+	atomic.StoreInt64((*int64)(i), v)
+}
+
+// Add 原子性地加上delta，返回新的值
+func (i *Int64) Add(delta int64) int64 {
+	return atomic.AddInt64((*int64)(i), delta)
+}
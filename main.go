@@ -3,20 +3,28 @@ package main
 import (
 	"GoRedis/config"
 	"GoRedis/lib/logger"
+	"GoRedis/lib/metrics"
 	"GoRedis/resp/handler"
 	"GoRedis/tcp"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
-// 设置配置文件的名字
-const configFile string = "redis.conf"
+// 命令行中没有指定配置文件时，使用当前目录下的配置文件
+const defaultConfigFile string = "redis.conf"
 
-// 默认配置
-var defaultProperties = &config.ServerProperties{
-	Bind: "0.0.0.0",
-	Port: 63791,
-}
+const usage = `Usage: ./GoRedis [/path/to/redis.conf] [options]
+       ./GoRedis -h or --help
+
+Examples:
+       ./GoRedis (run the server with redis.conf in the current directory, or default config)
+       ./GoRedis /etc/redis/63791.conf
+       ./GoRedis --port 7777
+       ./GoRedis /etc/myredis.conf --maxmemory 512mb --appendonly yes
+`
 
 // 判断文件是否存在
 func fileExists(filename string) bool {
@@ -24,30 +32,120 @@ func fileExists(filename string) bool {
 	return err == nil && !info.IsDir()
 }
 
-// 1. 初始化日志
-// 2. 导入配置文件
+// 重新打开日志文件，配合 logrotate 使用
+// 然后重新加载配置文件，可以在运行时修改的配置立即生效，其他修改过的配置需要重启
+func reload() {
+	if err := logger.Reopen(); err != nil {
+		logger.Error("reopen log file: " + err.Error())
+	}
+	logger.Info("received SIGHUP, reloading config file")
+	result, err := config.Reload()
+	if err != nil {
+		logger.Error("config reload failed, keeping the current config: " + err.Error())
+		return
+	}
+	if len(result.Applied) > 0 {
+		logger.Info("config reloaded, applied: " + strings.Join(result.Applied, ", "))
+	} else {
+		logger.Info("config reloaded, no hot-reloadable setting changed")
+	}
+	if len(result.RestartRequired) > 0 {
+		logger.Warn("changed settings that require a restart: " + strings.Join(result.RestartRequired, ", "))
+	}
+}
+
+// 1. 导入配置文件
+// 2. 初始化日志
 func main() {
+	if len(os.Args) == 2 && (os.Args[1] == "-h" || os.Args[1] == "--help") {
+		fmt.Print(usage)
+		return
+	}
+	filename, overrides, err := config.ParseArgs(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(1)
+	}
+	// 判断配置文件是否存在
+	if filename == "" && fileExists(defaultConfigFile) {
+		filename = defaultConfigFile
+	}
+	if err := config.Setup(filename, overrides); err != nil {
+		fmt.Fprintln(os.Stderr, "*** FATAL CONFIG FILE ERROR ***")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
 	// 初始化日志
 	logger.Setup(&logger.Settings{
-		Path:       "logs",
-		Name:       "GoRedis",
-		Ext:        "log",
-		TimeFormat: "2006-01-02",
+		Path:           "logs",
+		Name:           "GoRedis",
+		Ext:            "log",
+		TimeFormat:     "2006-01-02",
+		Level:          config.Properties().LogLevel,
+		MaxSize:        int64(config.Properties().LogMaxSize),
+		MaxBackups:     config.Properties().LogMaxFiles,
+		JSON:           config.Properties().LogFormat == "json",
+		Syslog:         config.Properties().SyslogEnabled,
+		SyslogIdent:    config.Properties().SyslogIdent,
+		SyslogFacility: config.Properties().SyslogFacility,
+	})
+	config.RegisterApplyFunc("loglevel", func(p *config.ServerProperties) error {
+		return logger.SetLevel(p.LogLevel)
 	})
 
-	// 判断配置文件是否存在
-	if fileExists(configFile) {
-		config.SetupConfig(configFile)
-	} else {
-		config.Properties = defaultProperties
+	tcpConfig := &tcp.Config{
+		KeepAlive: time.Duration(config.Properties().TcpKeepalive) * time.Second,
+		// 收到 SIGHUP 时重新打开日志文件并重新加载配置文件
+		OnHangup: reload,
+	}
+	// port 为0时不监听明文端口
+	if config.Properties().Port > 0 {
+		tcpConfig.Address = fmt.Sprintf("%s:%d", config.Properties().Bind, config.Properties().Port)
+	}
+	// 开启TLS
+	if config.Properties().TlsPort > 0 {
+		tlsConfig, err := tcp.MakeTLSConfig(
+			config.Properties().TlsCertFile,
+			config.Properties().TlsKeyFile,
+			config.Properties().TlsCaCertFile,
+			config.Properties().TlsAuthClients)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		tcpConfig.TLSAddress = fmt.Sprintf("%s:%d", config.Properties().Bind, config.Properties().TlsPort)
+		tcpConfig.TLSConfig = tlsConfig
+	}
+
+	// 开启 Unix socket
+	if config.Properties().UnixSocket != "" {
+		tcpConfig.UnixSocket = config.Properties().UnixSocket
+		if config.Properties().UnixSocketPerm != "" {
+			perm, err := strconv.ParseUint(config.Properties().UnixSocketPerm, 8, 32)
+			if err != nil {
+				logger.Fatal("invalid unixsocketperm: " + config.Properties().UnixSocketPerm)
+			}
+			tcpConfig.UnixSocketPerm = os.FileMode(perm)
+		}
+	}
+
+	// 调用resp层的handler
+	respHandler := handler.MakeHandler()
+
+	// 开启 Prometheus 指标
+	if config.Properties().MetricsPort > 0 {
+		address := fmt.Sprintf("%s:%d", config.Properties().Bind, config.Properties().MetricsPort)
+		metricsServer, err := metrics.Listen(address, respHandler)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer func() {
+			_ = metricsServer.Close()
+		}()
 	}
 
-	err := tcp.ListenAndServeWithSignal(
-		&tcp.Config{
-			Address: fmt.Sprintf("%s:%d", config.Properties.Bind, config.Properties.Port),
-		},
-		// 调用resp层的handler
-		handler.MakeHandler())
+	err = tcp.ListenAndServeWithSignal(tcpConfig, respHandler)
 	if err != nil {
 		logger.Error(err)
 	}
@@ -1,17 +1,34 @@
 package pubsub
 
-import "GoRedis/datastruct/dict"
+import (
+	"GoRedis/datastruct/dict"
+	"GoRedis/datastruct/list"
+	"GoRedis/lib/sync/lock"
+	"GoRedis/lib/wildcard"
+)
 
 // Hub 储存所有的订阅关系
 // 该map是map[string]*List结构，List中存的是客户端结构体，储存的是频道和频道的订阅者链表
 type Hub struct {
 	// channel -> list(*Client)
 	subs dict.Dict
+	// pattern -> *patternSubscribers
+	patterns dict.Dict
+	// 订阅和退订时给频道或模式加锁
+	subsLocker *lock.Locks
+}
+
+// 模式的订阅者，模式在订阅时编译好，发布消息时直接匹配
+type patternSubscribers struct {
+	pattern     *wildcard.Pattern
+	subscribers *list.LinkedList
 }
 
 // MakeHub creates new hub
 func MakeHub() *Hub {
 	return &Hub{
-		subs: dict.MakeSyncDict(),
+		subs:       dict.MakeSyncDict(),
+		patterns:   dict.MakeSyncDict(),
+		subsLocker: lock.Make(16),
 	}
 }
@@ -4,21 +4,64 @@ import (
 	"GoRedis/datastruct/list"
 	"GoRedis/interface/resp"
 	"GoRedis/lib/utils"
+	"GoRedis/lib/wildcard"
 	"GoRedis/resp/reply"
-	"strconv"
+	"strings"
 )
 
 var (
-	_subscribe         = "subscribe"
-	_unsubscribe       = "unsubscribe"
-	messageBytes       = []byte("message")
-	unSubscribeNothing = []byte("*3\r\n$11\r\nunsubscribe\r\n$-1\n:0\r\n")
+	_subscribe    = "subscribe"
+	_unsubscribe  = "unsubscribe"
+	_psubscribe   = "psubscribe"
+	_punsubscribe = "punsubscribe"
+	messageBytes  = []byte("message")
+	pMessageBytes = []byte("pmessage")
+	pongBytes     = []byte("pong")
 )
 
-func makeMsg(t string, channel string, code int64) []byte {
-	return []byte("*3\r\n$" + strconv.FormatInt(int64(len(t)), 10) + reply.CRLF + t + reply.CRLF +
-		"$" + strconv.FormatInt(int64(len(channel)), 10) + reply.CRLF + channel + reply.CRLF +
-		":" + strconv.FormatInt(code, 10) + reply.CRLF)
+// 订阅和退订的回复，RESP3中以推送的格式发送
+func makeMsg(t string, channel string, code int64) resp.Reply {
+	return reply.MakePushReply([]resp.Reply{
+		reply.MakeBulkReply([]byte(t)),
+		reply.MakeBulkReply([]byte(channel)),
+		reply.MakeIntReply(code),
+	})
+}
+
+// 没有可以退订的频道或模式时，频道名称为nil
+func makeNilMsg(t string, code int64) resp.Reply {
+	return reply.MakePushReply([]resp.Reply{
+		reply.MakeBulkReply([]byte(t)),
+		reply.MakeNullBulkReply(),
+		reply.MakeIntReply(code),
+	})
+}
+
+// 按照客户端的协议版本回复
+func write(c resp.Connection, r resp.Reply) {
+	_ = c.Write(reply.Encode(r, c.GetProtocol()))
+}
+
+// 消息在两种协议下的编码，发布时每种编码只生成一次
+type encodedMsg struct {
+	resp2 []byte
+	resp3 []byte
+}
+
+func encodeMsg(msg *reply.PushReply) *encodedMsg {
+	return &encodedMsg{
+		resp2: msg.ToBytes(),
+		resp3: msg.ToResp3Bytes(),
+	}
+}
+
+// 按照客户端的协议版本发送消息
+func (m *encodedMsg) writeTo(c resp.Connection) {
+	if c.GetProtocol() == reply.Resp3 {
+		_ = c.Write(m.resp3)
+	} else {
+		_ = c.Write(m.resp2)
+	}
 }
 
 /*
@@ -85,11 +128,13 @@ func Subscribe(hub *Hub, c resp.Connection, args [][]byte) resp.Reply {
 		channels[i] = string(b)
 	}
 
+	hub.subsLocker.RWLocks(channels, nil)
+	defer hub.subsLocker.RWUnLocks(channels, nil)
+
 	for _, channel := range channels {
-		if subscribe0(hub, channel, c) {
-			// 向客户端返回订阅的频道数量
-			_ = c.Write(makeMsg(_subscribe, channel, int64(c.SubsCount())))
-		}
+		subscribe0(hub, channel, c)
+		// 和Redis一样，重复订阅也要回复，返回当前订阅的频道和模式的总数
+		write(c, makeMsg(_subscribe, channel, int64(c.SubsCount())))
 	}
 	return &reply.NoReply{}
 }
@@ -98,6 +143,9 @@ func Subscribe(hub *Hub, c resp.Connection, args [][]byte) resp.Reply {
 func UnsubscribeAll(hub *Hub, c resp.Connection) {
 	channels := c.GetChannels()
 
+	hub.subsLocker.RWLocks(channels, nil)
+	defer hub.subsLocker.RWUnLocks(channels, nil)
+
 	for _, channel := range channels {
 		unsubscribe0(hub, channel, c)
 	}
@@ -117,20 +165,22 @@ func UnSubscribe(db *Hub, c resp.Connection, args [][]byte) resp.Reply {
 	}
 
 	if len(channels) == 0 {
-		_ = c.Write(unSubscribeNothing)
+		write(c, makeNilMsg(_unsubscribe, int64(c.SubsCount())))
 		return &reply.NoReply{}
 	}
 
+	db.subsLocker.RWLocks(channels, nil)
+	defer db.subsLocker.RWUnLocks(channels, nil)
+
 	for _, channel := range channels {
-		if unsubscribe0(db, channel, c) {
-			// 返回退订的频道，以及当前订阅的频道数量
-			_ = c.Write(makeMsg(_unsubscribe, channel, int64(c.SubsCount())))
-		}
+		unsubscribe0(db, channel, c)
+		// 每个频道回复一次，返回退订的频道，以及当前订阅的频道和模式的总数
+		write(c, makeMsg(_unsubscribe, channel, int64(c.SubsCount())))
 	}
 	return &reply.NoReply{}
 }
 
-// Publish 向订阅频道的所有订阅者发送消息
+// Publish 向订阅频道的所有订阅者以及匹配该频道的模式的订阅者发送消息
 func Publish(hub *Hub, args [][]byte) resp.Reply {
 	if len(args) != 2 {
 		return &reply.ArgNumErrReply{Cmd: "publish"}
@@ -138,25 +188,296 @@ func Publish(hub *Hub, args [][]byte) resp.Reply {
 	channel := string(args[0])
 	message := args[1]
 
+	// 频道和匹配的模式一起加锁
+	patterns := matchPatterns(hub, channel)
+	lockKeys := make([]string, 0, len(patterns)+1)
+	lockKeys = append(lockKeys, channel)
+	for pattern := range patterns {
+		lockKeys = append(lockKeys, pattern)
+	}
+	hub.subsLocker.RWLocks(nil, lockKeys)
+	defer hub.subsLocker.RWUnLocks(nil, lockKeys)
+
+	// 收到消息的客户端数量
+	receivers := 0
 	// 从map中取出频道以及订阅该频道的订阅者链表
 	raw, ok := hub.subs.Get(channel)
-	if !ok {
-		return reply.MakeIntReply(0)
-	}
-	subscribers, _ := raw.(*list.LinkedList)
-	subscribers.ForEach(func(i int, c interface{}) bool {
-		client, _ := c.(resp.Connection)
+	if ok {
+		subscribers, _ := raw.(*list.LinkedList)
 		// 发送的消息分为三个部分：
 		// 1. "message" 固定字段
 		// 2. 频道名称
 		// 3. 消息本体
-		replyArgs := make([][]byte, 3)
-		replyArgs[0] = messageBytes
-		replyArgs[1] = []byte(channel)
-		replyArgs[2] = message
-		// 向客户端发送消息
-		_ = client.Write(reply.MakeMultiBulkReply(replyArgs).ToBytes())
+		msg := encodeMsg(reply.MakePushReply([]resp.Reply{
+			reply.MakeBulkReply(messageBytes),
+			reply.MakeBulkReply([]byte(channel)),
+			reply.MakeBulkReply(message),
+		}))
+		subscribers.ForEach(func(i int, c interface{}) bool {
+			client, _ := c.(resp.Connection)
+			// 向客户端发送消息
+			msg.writeTo(client)
+			return true
+		})
+		receivers += subscribers.Len()
+	}
+	receivers += publishToPatterns(patterns, channel, message)
+	return reply.MakeIntReply(int64(receivers))
+}
+
+/*
+ * 模式订阅
+ */
+
+/*
+ * invoker should lock pattern
+ * return: is new subscribed
+ */
+// 订阅模式
+func psubscribe0(hub *Hub, pattern string, client resp.Connection) bool {
+	client.PSubscribe(pattern)
+
+	var ps *patternSubscribers
+	raw, ok := hub.patterns.Get(pattern)
+	if ok {
+		ps, _ = raw.(*patternSubscribers)
+	} else {
+		ps = &patternSubscribers{
+			pattern:     wildcard.CompilePattern(pattern),
+			subscribers: list.Make(),
+		}
+		hub.patterns.Put(pattern, ps)
+	}
+	if ps.subscribers.Contains(func(a interface{}) bool {
+		return a == client
+	}) {
+		return false
+	}
+	ps.subscribers.Add(client)
+	return true
+}
+
+/*
+ * invoker should lock pattern
+ * return: is actually un-subscribe
+ */
+// 退订模式
+func punsubscribe0(hub *Hub, pattern string, client resp.Connection) bool {
+	client.PUnSubscribe(pattern)
+
+	raw, ok := hub.patterns.Get(pattern)
+	if !ok {
+		return false
+	}
+	ps, _ := raw.(*patternSubscribers)
+	ps.subscribers.RemoveAllByVal(func(a interface{}) bool {
+		return utils.Equals(a, client)
+	})
+	if ps.subscribers.Len() == 0 {
+		hub.patterns.Remove(pattern)
+	}
+	return true
+}
+
+// PSubscribe 将客户端订阅到给定的模式上
+func PSubscribe(hub *Hub, c resp.Connection, args [][]byte) resp.Reply {
+	patterns := make([]string, len(args))
+	for i, b := range args {
+		patterns[i] = string(b)
+	}
+
+	hub.subsLocker.RWLocks(patterns, nil)
+	defer hub.subsLocker.RWUnLocks(patterns, nil)
+
+	for _, pattern := range patterns {
+		psubscribe0(hub, pattern, c)
+		// 向客户端返回订阅的频道和模式的总数
+		write(c, makeMsg(_psubscribe, pattern, int64(c.SubsCount())))
+	}
+	return &reply.NoReply{}
+}
+
+// PUnSubscribe 客户端退订给定的模式，没有给定模式时退订所有模式
+func PUnSubscribe(hub *Hub, c resp.Connection, args [][]byte) resp.Reply {
+	var patterns []string
+	if len(args) > 0 {
+		patterns = make([]string, len(args))
+		for i, b := range args {
+			patterns[i] = string(b)
+		}
+	} else {
+		patterns = c.GetPatterns()
+	}
+
+	if len(patterns) == 0 {
+		write(c, makeNilMsg(_punsubscribe, int64(c.SubsCount())))
+		return &reply.NoReply{}
+	}
+
+	hub.subsLocker.RWLocks(patterns, nil)
+	defer hub.subsLocker.RWUnLocks(patterns, nil)
+
+	for _, pattern := range patterns {
+		punsubscribe0(hub, pattern, c)
+		// 和Redis一样，即使没有订阅过该模式也要回复
+		write(c, makeMsg(_punsubscribe, pattern, int64(c.SubsCount())))
+	}
+	return &reply.NoReply{}
+}
+
+// PUnsubscribeAll 退订所有模式
+func PUnsubscribeAll(hub *Hub, c resp.Connection) {
+	patterns := c.GetPatterns()
+
+	hub.subsLocker.RWLocks(patterns, nil)
+	defer hub.subsLocker.RWUnLocks(patterns, nil)
+
+	for _, pattern := range patterns {
+		punsubscribe0(hub, pattern, c)
+	}
+}
+
+// 找出所有匹配频道的模式
+func matchPatterns(hub *Hub, channel string) map[string]*patternSubscribers {
+	matched := make(map[string]*patternSubscribers)
+	hub.patterns.ForEach(func(pattern string, val interface{}) bool {
+		ps, _ := val.(*patternSubscribers)
+		if ps.pattern.IsMatch(channel) {
+			matched[pattern] = ps
+		}
 		return true
 	})
-	return reply.MakeIntReply(int64(subscribers.Len()))
+	return matched
+}
+
+// 向匹配频道的模式的订阅者发送pmessage，返回收到消息的客户端数量
+// invoker should lock patterns
+func publishToPatterns(patterns map[string]*patternSubscribers, channel string, message []byte) int {
+	receivers := 0
+	for pattern, ps := range patterns {
+		// pmessage的四个部分：固定字段、模式、频道名称、消息本体
+		msg := encodeMsg(reply.MakePushReply([]resp.Reply{
+			reply.MakeBulkReply(pMessageBytes),
+			reply.MakeBulkReply([]byte(pattern)),
+			reply.MakeBulkReply([]byte(channel)),
+			reply.MakeBulkReply(message),
+		}))
+		ps.subscribers.ForEach(func(i int, c interface{}) bool {
+			client, _ := c.(resp.Connection)
+			msg.writeTo(client)
+			return true
+		})
+		receivers += ps.subscribers.Len()
+	}
+	return receivers
+}
+
+/*
+ * PUBSUB 内省命令
+ */
+
+// NumChannels 返回有订阅者的频道数量
+func NumChannels(hub *Hub) int {
+	return hub.subs.Len()
+}
+
+// NumPatterns 返回有订阅者的模式数量
+func NumPatterns(hub *Hub) int {
+	return hub.patterns.Len()
+}
+
+// NumSubscribers 返回所有频道的订阅者数量之和
+func NumSubscribers(hub *Hub) int {
+	channels := make([]string, 0, hub.subs.Len())
+	hub.subs.ForEach(func(channel string, val interface{}) bool {
+		channels = append(channels, channel)
+		return true
+	})
+
+	hub.subsLocker.RWLocks(nil, channels)
+	defer hub.subsLocker.RWUnLocks(nil, channels)
+
+	count := 0
+	for _, channel := range channels {
+		if raw, ok := hub.subs.Get(channel); ok {
+			count += raw.(*list.LinkedList).Len()
+		}
+	}
+	return count
+}
+
+// PubSub PUBSUB CHANNELS [pattern] | NUMSUB [channel ...] | NUMPAT
+func PubSub(hub *Hub, args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("pubsub")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "channels":
+		if len(args) > 2 {
+			return reply.MakeErrReply("ERR wrong number of arguments for 'pubsub|channels' command")
+		}
+		var pattern *wildcard.Pattern
+		if len(args) == 2 {
+			pattern = wildcard.CompilePattern(string(args[1]))
+		}
+		return channels(hub, pattern)
+	case "numsub":
+		return numSub(hub, args[1:])
+	case "numpat":
+		if len(args) != 1 {
+			return reply.MakeErrReply("ERR wrong number of arguments for 'pubsub|numpat' command")
+		}
+		return reply.MakeIntReply(int64(hub.patterns.Len()))
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + subCmd + "'. Try PUBSUB HELP.")
+}
+
+// 返回所有有订阅者的频道，pattern不为nil时只返回匹配的频道
+// 频道在最后一个订阅者退订时会被删除，所以subs中的频道都是活跃的
+func channels(hub *Hub, pattern *wildcard.Pattern) resp.Reply {
+	result := make([][]byte, 0)
+	hub.subs.ForEach(func(channel string, val interface{}) bool {
+		if pattern == nil || pattern.IsMatch(channel) {
+			result = append(result, []byte(channel))
+		}
+		return true
+	})
+	return reply.MakeMultiBulkReply(result)
+}
+
+// 返回给定频道的订阅者数量，格式为 频道1 数量1 频道2 数量2 ...
+func numSub(hub *Hub, args [][]byte) resp.Reply {
+	channels := make([]string, len(args))
+	for i, b := range args {
+		channels[i] = string(b)
+	}
+
+	hub.subsLocker.RWLocks(nil, channels)
+	defer hub.subsLocker.RWUnLocks(nil, channels)
+
+	result := make([]resp.Reply, 0, len(channels)*2)
+	for _, channel := range channels {
+		count := 0
+		raw, ok := hub.subs.Get(channel)
+		if ok {
+			subscribers, _ := raw.(*list.LinkedList)
+			count = subscribers.Len()
+		}
+		result = append(result, reply.MakeBulkReply([]byte(channel)), reply.MakeIntReply(int64(count)))
+	}
+	return reply.MakeMapReply(result)
+}
+
+// Ping 订阅模式下的PING，以 pong 消息的格式回复
+// PING [message]
+func Ping(args [][]byte) resp.Reply {
+	if len(args) > 1 {
+		return reply.MakeArgNumErrReply("ping")
+	}
+	message := []byte{}
+	if len(args) == 1 {
+		message = args[0]
+	}
+	return reply.MakeMultiBulkReply([][]byte{pongBytes, message})
 }
@@ -0,0 +1,231 @@
+package connection
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*--- CLIENT命令使用的客户端信息 ---*/
+
+// CLIENT REPLY 的回复模式
+const (
+	// 不回复任何命令
+	replyOff = 1 << iota
+	// 不回复当前命令
+	replySkip
+	// 不回复下一条命令
+	replySkipNext
+)
+
+// GetID 返回客户端的唯一ID
+func (c *Connection) GetID() int64 {
+	return c.id
+}
+
+// GetName 返回客户端的名称
+func (c *Connection) GetName() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.name
+}
+
+// IsValidName 客户端名称只能包含可见字符，并且不能有空格
+func IsValidName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] < '!' || name[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// SetName 设置客户端的名称
+func (c *Connection) SetName(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.name = name
+}
+
+// LocalAddr 返回本地地址
+func (c *Connection) LocalAddr() string {
+	if c.conn == nil {
+		return ""
+	}
+	return c.conn.LocalAddr().String()
+}
+
+// Addr 返回远程地址，Unix socket 的客户端没有地址，和Redis一样显示为 <socket路径>:0
+func (c *Connection) Addr() string {
+	if c.conn == nil {
+		return ""
+	}
+	addr := c.conn.RemoteAddr()
+	if addr.Network() == "unix" {
+		return c.conn.LocalAddr().String() + ":0"
+	}
+	return addr.String()
+}
+
+// BeforeCommand 在执行命令之前记录命令名称和时间
+func (c *Connection) BeforeCommand(cmdName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastCmd = cmdName
+	c.lastInteraction = time.Now()
+}
+
+// IdleTime 返回距离上一次执行命令的时间
+func (c *Connection) IdleTime() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return time.Since(c.lastInteraction)
+}
+
+// SetNoEvict 设置 CLIENT NO-EVICT
+func (c *Connection) SetNoEvict(noEvict bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.noEvict = noEvict
+}
+
+// Class 返回客户端的类型
+func (c *Connection) Class() int {
+	return c.class()
+}
+
+/*
+ * CLIENT REPLY
+ */
+
+// SetReplyMode 设置回复模式 ON、OFF、SKIP
+func (c *Connection) SetReplyMode(mode string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch strings.ToLower(mode) {
+	case "on":
+		c.replyFlags &^= replyOff | replySkip | replySkipNext
+	case "off":
+		c.replyFlags |= replyOff
+	case "skip":
+		// SKIP 本身也不回复
+		if c.replyFlags&replyOff == 0 {
+			c.replyFlags |= replySkip | replySkipNext
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// ShouldReply 判断当前命令的回复是否需要发送
+func (c *Connection) ShouldReply() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.replyFlags&(replyOff|replySkip) == 0
+}
+
+// AfterCommand 命令执行完毕之后更新回复模式，SKIP只对下一条命令生效
+func (c *Connection) AfterCommand() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.replyFlags&replySkip != 0 {
+		c.replyFlags &^= replySkip
+	}
+	if c.replyFlags&replySkipNext != 0 {
+		c.replyFlags |= replySkip
+		c.replyFlags &^= replySkipNext
+	}
+}
+
+// SetMonitor 将客户端切换为监视器
+func (c *Connection) SetMonitor() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.monitor = true
+}
+
+// IsMonitor 判断客户端是否执行了 MONITOR
+func (c *Connection) IsMonitor() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.monitor
+}
+
+// IsAuthenticated 判断客户端是否通过了认证
+func (c *Connection) IsAuthenticated() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.authenticated
+}
+
+// SetAuthenticated 设置客户端的认证状态
+func (c *Connection) SetAuthenticated(authenticated bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.authenticated = authenticated
+}
+
+// SetCloseAfterReply 回复当前命令之后关闭连接
+func (c *Connection) SetCloseAfterReply() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closeAfterReply = true
+}
+
+// CloseAfterReply 判断是否需要在回复之后关闭连接
+func (c *Connection) CloseAfterReply() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeAfterReply
+}
+
+// 客户端的标志，和Redis一致
+func (c *Connection) flags() string {
+	var flags strings.Builder
+	if len(c.subs)+len(c.psubs) > 0 {
+		flags.WriteByte('P')
+	}
+	if c.monitor {
+		flags.WriteByte('O')
+	}
+	if c.multiState {
+		flags.WriteByte('x')
+	}
+	if c.noEvict {
+		flags.WriteByte('e')
+	}
+	if flags.Len() == 0 {
+		return "N"
+	}
+	return flags.String()
+}
+
+// Info 返回 CLIENT LIST 和 CLIENT INFO 中的一行客户端信息
+func (c *Connection) Info() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	multi := -1
+	if c.multiState {
+		multi = len(c.queue)
+	}
+	fields := []string{
+		"id=" + strconv.FormatInt(c.id, 10),
+		"addr=" + c.Addr(),
+		"laddr=" + c.LocalAddr(),
+		"name=" + c.name,
+		"age=" + strconv.FormatInt(int64(now.Sub(c.createdAt).Seconds()), 10),
+		"idle=" + strconv.FormatInt(int64(now.Sub(c.lastInteraction).Seconds()), 10),
+		"flags=" + c.flags(),
+		"db=" + strconv.Itoa(c.selectedDB),
+		"sub=" + strconv.Itoa(len(c.subs)),
+		"psub=" + strconv.Itoa(len(c.psubs)),
+		"multi=" + strconv.Itoa(multi),
+		"omem=" + strconv.Itoa(c.outputLen()),
+		"cmd=" + c.lastCmd,
+		"user=default",
+		"resp=" + strconv.Itoa(c.GetProtocol()),
+	}
+	return strings.Join(fields, " ")
+}
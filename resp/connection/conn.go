@@ -1,24 +1,82 @@
 package connection
 
 import (
-	"GoRedis/lib/sync/wait"
+	"GoRedis/config"
+	"GoRedis/lib/logger"
+	"GoRedis/resp/reply"
+	"bytes"
+	"errors"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+var errClosed = errors.New("connection closed")
+
+// 上一个分配的客户端ID
+var nextID int64
+
 // Connection 协议层与每个客户端连接的描述
 type Connection struct {
 	conn net.Conn
-	// 为了防止服务端被杀掉，在杀掉之前，需要把连接的客户端的所有服务处理完
-	waitingReply wait.Wait
 	// 操作一个客户端时上锁
 	mu sync.Mutex
-	// 切换数据库
+
+	/*
+	 * 客户端信息，通过CLIENT命令查看
+	 */
+	// 客户端的唯一ID，从1开始递增
+	id int64
+	// 客户端的名称
+	name string
+	// 连接创建的时间
+	createdAt time.Time
+	// 最后一次执行命令的时间
+	lastInteraction time.Time
+	// 最后一次执行的命令
+	lastCmd string
+	// 是否开启 CLIENT NO-EVICT
+	noEvict bool
+	// CLIENT REPLY 设置的回复模式
+	replyFlags int
+	// 回复之后关闭连接
+	closeAfterReply bool
+	// 是否执行了 MONITOR
+	monitor bool
+	// 是否通过了密码认证，没有设置密码时新连接默认已认证
+	authenticated bool
+
+	/*
+	 * 输出缓冲区
+	 * 回复先写入输出缓冲区，由单独的协程发送给客户端，写回复的协程不会被读取缓慢的客户端阻塞
+	 * 流水线中的回复在缓冲区中合并，一次系统调用发送
+	 */
+	// 等待发送的回复
+	pending *bytes.Buffer
+	// 正在发送的回复
+	sending *bytes.Buffer
+	// 有数据需要发送或者连接关闭时通知发送协程
+	cond *sync.Cond
+	// 发送协程退出时关闭
+	done chan struct{}
+	// 缓冲区中的数据是否需要立即发送
+	flushing bool
+	// 连接正在关闭
+	closing bool
+	// 发送时出现的错误
+	writeErr error
+	// 第一次超过软限制的时间
+	softLimitReachedAt time.Time
+	// 切换数据库，CLIENT LIST 会在其他协程中读取，访问时需要持有mu
 	selectedDB int
+	// 客户端使用的RESP协议版本，通过HELLO命令协商
+	// 发布消息的协程也会读取，使用原子操作
+	protocol int32
 
 	/*
 	 * 事务相关
+	 * CLIENT LIST 会在其他客户端的协程中读取，访问这些字段和订阅的频道时需要持有mu
 	 */
 	// 事务是否在执行
 	multiState bool
@@ -34,12 +92,27 @@ type Connection struct {
 	 */
 	// 当前客户端订阅的频道
 	subs map[string]bool
+	// 当前客户端订阅的模式
+	psubs map[string]bool
+	// 订阅的频道和模式的总数，定时任务和检查输出缓冲区时在其他协程读取，使用原子操作
+	subsCount int32
 }
 
 func NewConn(conn net.Conn) *Connection {
-	return &Connection{
-		conn: conn,
+	now := time.Now()
+	c := &Connection{
+		conn:            conn,
+		id:              atomic.AddInt64(&nextID, 1),
+		createdAt:       now,
+		lastInteraction: now,
+		pending:         &bytes.Buffer{},
+		sending:         &bytes.Buffer{},
+		done:            make(chan struct{}),
+		authenticated:   config.Properties().RequirePass == "",
 	}
+	c.cond = sync.NewCond(&c.mu)
+	go c.writeLoop()
+	return c
 }
 
 // RemoteAddr 返回远程主机地址
@@ -49,49 +122,180 @@ func (c *Connection) RemoteAddr() net.Addr {
 
 // Close 超时结束
 func (c *Connection) Close() error {
-	c.waitingReply.WaitWithTimeout(10 * time.Second)
+	c.mu.Lock()
+	c.closing = true
+	c.cond.Signal()
+	c.mu.Unlock()
+	// 关闭之前把缓冲区中剩余的回复发出去
+	select {
+	case <-c.done:
+	case <-time.After(10 * time.Second):
+	}
 	_ = c.conn.Close()
 	return nil
 }
 
-// Write 向客户端发送回复
+// Write 向客户端发送回复，并立即发送缓冲区中的所有数据
+// 发布订阅的消息也通过这个方法发送，保证消息及时送达
 func (c *Connection) Write(b []byte) error {
+	return c.write(b, true)
+}
+
+// WriteBuffered 将回复写入缓冲区，不立即发送
+// 缓冲区中的数据需要调用Flush或者Write发送
+func (c *Connection) WriteBuffered(b []byte) error {
+	return c.write(b, false)
+}
+
+// Flush 发送缓冲区中的所有数据
+func (c *Connection) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.writeErr != nil {
+		return c.writeErr
+	}
+	if c.pending.Len() > 0 {
+		c.flushing = true
+		c.cond.Signal()
+	}
+	return nil
+}
+
+// 将回复写入输出缓冲区，超过限制时异步断开客户端
+func (c *Connection) write(b []byte, flush bool) error {
 	if len(b) == 0 {
 		return nil
 	}
-	// 同一时刻只能一个协程给客户端写数据
 	c.mu.Lock()
-	c.waitingReply.Add(1)
-	defer func() {
-		c.waitingReply.Done()
+	defer c.mu.Unlock()
+
+	if c.writeErr != nil {
+		return c.writeErr
+	}
+	if c.closing {
+		return errClosed
+	}
+	c.pending.Write(b)
+	if c.checkOutputBufferLimit() {
+		c.closeAsync()
+		return errClosed
+	}
+	if flush {
+		c.flushing = true
+		c.cond.Signal()
+	}
+	return nil
+}
+
+// 丢弃缓冲区中的数据并关闭连接，调用者需要持有c.mu
+// 关闭连接后读取命令的协程会出错退出，由协议层完成后续的清理
+func (c *Connection) closeAsync() {
+	logger.With("addr", c.RemoteAddr().String()).Warn("client closed for overcoming of output buffer limits")
+	c.kill()
+}
+
+// Kill 丢弃缓冲区中的数据并断开客户端
+func (c *Connection) Kill() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.kill()
+}
+
+// 调用者需要持有c.mu
+func (c *Connection) kill() {
+	c.writeErr = errClosed
+	c.closing = true
+	c.pending.Reset()
+	c.cond.Signal()
+	_ = c.conn.Close()
+}
+
+// 输出缓冲区中的字节数，调用者需要持有c.mu
+func (c *Connection) outputLen() int {
+	return c.pending.Len() + c.sending.Len()
+}
+
+// OutputLen 返回输出缓冲区中的字节数
+func (c *Connection) OutputLen() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.outputLen()
+}
+
+// 发送协程，将缓冲区中的数据发送给客户端
+func (c *Connection) writeLoop() {
+	defer close(c.done)
+	for {
+		c.mu.Lock()
+		for !(c.flushing && c.pending.Len() > 0) && !c.closing {
+			c.cond.Wait()
+		}
+		// 连接已经出错，或者关闭时没有剩余的数据
+		if c.writeErr != nil || (c.closing && c.pending.Len() == 0) {
+			c.mu.Unlock()
+			return
+		}
+		// 交换两个缓冲区，发送时其他协程可以继续写入
+		c.pending, c.sending = c.sending, c.pending
+		c.flushing = false
 		c.mu.Unlock()
-	}()
 
-	_, err := c.conn.Write(b)
-	return err
+		_, err := c.conn.Write(c.sending.Bytes())
+
+		c.mu.Lock()
+		c.sending.Reset()
+		if err != nil && c.writeErr == nil {
+			c.writeErr = err
+			c.pending.Reset()
+		}
+		c.mu.Unlock()
+	}
 }
 
 // GetDBIndex 返回当前在使用的数据库
 func (c *Connection) GetDBIndex() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.selectedDB
 }
 
 // SelectDB 选择数据库
 func (c *Connection) SelectDB(dbNum int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.selectedDB = dbNum
 }
 
+// GetProtocol 返回客户端使用的协议版本，默认是RESP2
+func (c *Connection) GetProtocol() int {
+	protocol := atomic.LoadInt32(&c.protocol)
+	if protocol == 0 {
+		return reply.Resp2
+	}
+	return int(protocol)
+}
+
+// SetProtocol 设置客户端使用的协议版本
+func (c *Connection) SetProtocol(protocol int) {
+	atomic.StoreInt32(&c.protocol, int32(protocol))
+}
+
 /*
  * 事务相关
  */
 
 // InMultiState 返回事务此刻的状态
 func (c *Connection) InMultiState() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.multiState
 }
 
 // SetMultiState 设置事务此刻的状态
 func (c *Connection) SetMultiState(state bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if !state {
 		c.watching = nil
 		c.queue = nil
@@ -101,16 +305,22 @@ func (c *Connection) SetMultiState(state bool) {
 
 // GetQueuedCmdLine 返回事务队列
 func (c *Connection) GetQueuedCmdLine() [][][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.queue
 }
 
 // EnqueueCmd 执行事务时的命令入队
 func (c *Connection) EnqueueCmd(cmdLine [][]byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.queue = append(c.queue, cmdLine)
 }
 
 // ClearQueuedCmd 清除事务队列
 func (c *Connection) ClearQueuedCmd() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.queue = nil
 }
 
@@ -145,6 +355,7 @@ func (c *Connection) Subscribe(channel string) {
 		c.subs = make(map[string]bool)
 	}
 	c.subs[channel] = true
+	c.updateSubsCount()
 }
 
 // UnSubscribe 取消将当前连接作为给定频道的连接者
@@ -156,15 +367,23 @@ func (c *Connection) UnSubscribe(channel string) {
 		return
 	}
 	delete(c.subs, channel)
+	c.updateSubsCount()
 }
 
-// SubsCount 返回频道的订阅者数量
+// SubsCount 返回客户端订阅的频道和模式的总数
 func (c *Connection) SubsCount() int {
-	return len(c.subs)
+	return int(atomic.LoadInt32(&c.subsCount))
+}
+
+// 订阅或退订之后更新总数，调用者需要持有c.mu
+func (c *Connection) updateSubsCount() {
+	atomic.StoreInt32(&c.subsCount, int32(len(c.subs)+len(c.psubs)))
 }
 
 // GetChannels 返回所有订阅的频道
 func (c *Connection) GetChannels() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if c.subs == nil {
 		return make([]string, 0)
 	}
@@ -176,3 +395,43 @@ func (c *Connection) GetChannels() []string {
 	}
 	return channels
 }
+
+// PSubscribe 将客户端订阅到给定的模式上
+func (c *Connection) PSubscribe(pattern string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.psubs == nil {
+		c.psubs = make(map[string]bool)
+	}
+	c.psubs[pattern] = true
+	c.updateSubsCount()
+}
+
+// PUnSubscribe 退订给定的模式
+func (c *Connection) PUnSubscribe(pattern string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.psubs) == 0 {
+		return
+	}
+	delete(c.psubs, pattern)
+	c.updateSubsCount()
+}
+
+// GetPatterns 返回所有订阅的模式
+func (c *Connection) GetPatterns() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.psubs == nil {
+		return make([]string, 0)
+	}
+	patterns := make([]string, len(c.psubs))
+	i := 0
+	for pattern := range c.psubs {
+		patterns[i] = pattern
+		i++
+	}
+	return patterns
+}
@@ -0,0 +1,151 @@
+package connection
+
+import (
+	"GoRedis/config"
+	"errors"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/*
+ * 客户端输出缓冲区限制
+ * 客户端读取回复的速度跟不上时，回复会堆积在输出缓冲区中
+ * 超过硬限制，或者超过软限制的时间达到设定的秒数，就断开客户端
+ */
+
+// 客户端的类型，不同类型使用不同的限制
+const (
+	ClassNormal = iota
+	ClassReplica
+	ClassPubSub
+	classCount
+)
+
+var classNames = []string{"normal", "replica", "pubsub"}
+
+// OutputBufferLimit 一类客户端的输出缓冲区限制，值为0表示不限制
+type OutputBufferLimit struct {
+	HardLimit   int64
+	SoftLimit   int64
+	SoftSeconds int64
+}
+
+// 默认限制，和Redis一致
+var defaultOutputBufferLimits = [classCount]OutputBufferLimit{
+	ClassNormal:  {0, 0, 0},
+	ClassReplica: {256 * 1024 * 1024, 64 * 1024 * 1024, 60},
+	ClassPubSub:  {32 * 1024 * 1024, 8 * 1024 * 1024, 60},
+}
+
+// 当前生效的限制，可以在运行时修改
+var outputBufferLimits atomic.Value
+
+func init() {
+	outputBufferLimits.Store(defaultOutputBufferLimits)
+	// 配置文件中的错误在启动时报出
+	config.RegisterValidator("client-output-buffer-limit", func(value string) error {
+		_, err := parseOutputBufferLimits(value, defaultOutputBufferLimits)
+		return err
+	})
+}
+
+// 解析客户端类型的名称，slave 是 replica 的旧名称
+func parseClass(name string) (int, bool) {
+	switch strings.ToLower(name) {
+	case "normal":
+		return ClassNormal, true
+	case "replica", "slave":
+		return ClassReplica, true
+	case "pubsub":
+		return ClassPubSub, true
+	}
+	return 0, false
+}
+
+// 解析 client-output-buffer-limit 配置，格式为 <class> <hard limit> <soft limit> <soft seconds>
+// 可以同时设置多类客户端，没有出现的类型保持 limits 中的限制
+func parseOutputBufferLimits(value string, limits [classCount]OutputBufferLimit) ([classCount]OutputBufferLimit, error) {
+	fields := strings.Fields(value)
+	if len(fields)%4 != 0 {
+		return limits, errors.New("Wrong number of arguments in buffer limit configuration.")
+	}
+	for i := 0; i < len(fields); i += 4 {
+		class, ok := parseClass(fields[i])
+		if !ok {
+			return limits, errors.New("Invalid client class specified in buffer limit configuration.")
+		}
+		hard, err := config.ParseMemory(fields[i+1])
+		if err != nil {
+			return limits, errLimitValue
+		}
+		soft, err := config.ParseMemory(fields[i+2])
+		if err != nil {
+			return limits, errLimitValue
+		}
+		seconds, err := strconv.ParseInt(fields[i+3], 10, 64)
+		if err != nil || seconds < 0 {
+			return limits, errLimitValue
+		}
+		limits[class] = OutputBufferLimit{
+			HardLimit:   hard,
+			SoftLimit:   soft,
+			SoftSeconds: seconds,
+		}
+	}
+	return limits, nil
+}
+
+var errLimitValue = errors.New("Error in hard, soft or soft_seconds setting in buffer limit configuration.")
+
+// SetOutputBufferLimits 修改 client-output-buffer-limit 配置，没有出现的类型保持原来的限制
+func SetOutputBufferLimits(value string) error {
+	limits, err := parseOutputBufferLimits(value, outputBufferLimits.Load().([classCount]OutputBufferLimit))
+	if err != nil {
+		return err
+	}
+	outputBufferLimits.Store(limits)
+	return nil
+}
+
+// GetOutputBufferLimits 返回当前的 client-output-buffer-limit 配置
+func GetOutputBufferLimits() string {
+	limits := outputBufferLimits.Load().([classCount]OutputBufferLimit)
+	parts := make([]string, 0, classCount)
+	for class, limit := range limits {
+		parts = append(parts, classNames[class]+" "+
+			strconv.FormatInt(limit.HardLimit, 10)+" "+
+			strconv.FormatInt(limit.SoftLimit, 10)+" "+
+			strconv.FormatInt(limit.SoftSeconds, 10))
+	}
+	return strings.Join(parts, " ")
+}
+
+// 返回客户端的类型
+func (c *Connection) class() int {
+	if c.SubsCount() > 0 {
+		return ClassPubSub
+	}
+	return ClassNormal
+}
+
+// 检查输出缓冲区是否超过限制，调用者需要持有c.mu
+func (c *Connection) checkOutputBufferLimit() bool {
+	limit := outputBufferLimits.Load().([classCount]OutputBufferLimit)[c.class()]
+	used := int64(c.outputLen())
+	if limit.HardLimit > 0 && used >= limit.HardLimit {
+		return true
+	}
+	if limit.SoftLimit > 0 && used >= limit.SoftLimit {
+		now := time.Now()
+		// 第一次超过软限制时记录时间
+		if c.softLimitReachedAt.IsZero() {
+			c.softLimitReachedAt = now
+			return false
+		}
+		return now.Sub(c.softLimitReachedAt) > time.Duration(limit.SoftSeconds)*time.Second
+	}
+	c.softLimitReachedAt = time.Time{}
+	return false
+}
@@ -0,0 +1,283 @@
+package handler
+
+import (
+	"GoRedis/interface/resp"
+	"GoRedis/resp/connection"
+	"GoRedis/resp/reply"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+ * CLIENT 命令
+ * 需要访问所有的连接，所以在协议层实现
+ */
+
+// 返回按照ID排序的所有客户端
+func (h *RespHandler) clients() []*connection.Connection {
+	clients := make([]*connection.Connection, 0)
+	h.activeConn.Range(func(key interface{}, val interface{}) bool {
+		clients = append(clients, key.(*connection.Connection))
+		return true
+	})
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].GetID() < clients[j].GetID()
+	})
+	return clients
+}
+
+// 解析客户端类型，master 在单机模式下没有对应的客户端
+func parseClientType(name string) (int, bool) {
+	switch strings.ToLower(name) {
+	case "normal":
+		return connection.ClassNormal, true
+	case "pubsub":
+		return connection.ClassPubSub, true
+	case "replica", "slave", "master":
+		return connection.ClassReplica, true
+	}
+	return 0, false
+}
+
+// CLIENT subcommand [arguments ...]
+func (h *RespHandler) execClient(c *connection.Connection, args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("client")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	args = args[1:]
+	switch subCmd {
+	case "id":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("client|id")
+		}
+		return reply.MakeIntReply(c.GetID())
+	case "info":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("client|info")
+		}
+		return reply.MakeVerbatimReply("txt", c.Info()+"\n")
+	case "list":
+		return h.execClientList(args)
+	case "kill":
+		return h.execClientKill(c, args)
+	case "setname":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("client|setname")
+		}
+		name := string(args[0])
+		if !connection.IsValidName(name) {
+			return reply.MakeErrReply("ERR Client names cannot contain spaces, newlines or special characters.")
+		}
+		c.SetName(name)
+		return reply.MakeOkReply()
+	case "getname":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("client|getname")
+		}
+		name := c.GetName()
+		if name == "" {
+			return reply.MakeNullBulkReply()
+		}
+		return reply.MakeBulkReply([]byte(name))
+	case "pause":
+		return h.execClientPause(args)
+	case "unpause":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("client|unpause")
+		}
+		h.paused.unpause()
+		return reply.MakeOkReply()
+	case "reply":
+		if len(args) != 1 || !c.SetReplyMode(string(args[0])) {
+			return reply.MakeSyntaxErrReply()
+		}
+		return reply.MakeOkReply()
+	case "no-evict":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("client|no-evict")
+		}
+		switch strings.ToLower(string(args[0])) {
+		case "on":
+			c.SetNoEvict(true)
+		case "off":
+			c.SetNoEvict(false)
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+		return reply.MakeOkReply()
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + subCmd + "'. Try CLIENT HELP.")
+}
+
+// CLIENT LIST [TYPE normal|pubsub|replica|master] [ID id [id ...]]
+func (h *RespHandler) execClientList(args [][]byte) resp.Reply {
+	class := -1
+	var ids map[int64]bool
+	if len(args) > 0 {
+		switch strings.ToLower(string(args[0])) {
+		case "type":
+			if len(args) != 2 {
+				return reply.MakeSyntaxErrReply()
+			}
+			var ok bool
+			class, ok = parseClientType(string(args[1]))
+			if !ok {
+				return reply.MakeErrReply("ERR Unknown client type '" + string(args[1]) + "'")
+			}
+		case "id":
+			if len(args) < 2 {
+				return reply.MakeSyntaxErrReply()
+			}
+			ids = make(map[int64]bool)
+			for _, arg := range args[1:] {
+				id, err := strconv.ParseInt(string(arg), 10, 64)
+				if err != nil || id <= 0 {
+					return reply.MakeErrReply("ERR Invalid client ID")
+				}
+				ids[id] = true
+			}
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	var buf strings.Builder
+	for _, client := range h.clients() {
+		if class >= 0 && client.Class() != class {
+			continue
+		}
+		if ids != nil && !ids[client.GetID()] {
+			continue
+		}
+		buf.WriteString(client.Info())
+		buf.WriteByte('\n')
+	}
+	return reply.MakeVerbatimReply("txt", buf.String())
+}
+
+// CLIENT KILL ip:port
+// CLIENT KILL [ID id] [ADDR ip:port] [LADDR ip:port] [USER username] [TYPE type] [SKIPME yes/no]
+func (h *RespHandler) execClientKill(c *connection.Connection, args [][]byte) resp.Reply {
+	// 旧的格式，只能按照地址断开，也可以断开自己
+	if len(args) == 1 {
+		addr := string(args[0])
+		for _, client := range h.clients() {
+			if client.Addr() == addr {
+				h.killClient(c, client)
+				return reply.MakeOkReply()
+			}
+		}
+		return reply.MakeErrReply("ERR No such client")
+	}
+	if len(args) == 0 || len(args)%2 != 0 {
+		return reply.MakeSyntaxErrReply()
+	}
+	var (
+		id        int64
+		addr      string
+		laddr     string
+		user      string
+		class     = -1
+		skipMe    = true
+		hasFilter bool
+	)
+	for i := 0; i < len(args); i += 2 {
+		value := string(args[i+1])
+		switch strings.ToLower(string(args[i])) {
+		case "id":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n <= 0 {
+				return reply.MakeErrReply("ERR client-id should be greater than 0")
+			}
+			id = n
+		case "addr":
+			addr = value
+		case "laddr":
+			laddr = value
+		case "user":
+			user = value
+		case "type":
+			var ok bool
+			class, ok = parseClientType(value)
+			if !ok {
+				return reply.MakeErrReply("ERR Unknown client type '" + value + "'")
+			}
+		case "skipme":
+			switch strings.ToLower(value) {
+			case "yes":
+				skipMe = true
+			case "no":
+				skipMe = false
+			default:
+				return reply.MakeSyntaxErrReply()
+			}
+			continue
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+		hasFilter = true
+	}
+	if !hasFilter {
+		return reply.MakeSyntaxErrReply()
+	}
+	killed := 0
+	for _, client := range h.clients() {
+		if id != 0 && client.GetID() != id {
+			continue
+		}
+		if addr != "" && client.Addr() != addr {
+			continue
+		}
+		if laddr != "" && client.LocalAddr() != laddr {
+			continue
+		}
+		// 只有默认用户
+		if user != "" && user != "default" {
+			continue
+		}
+		if class >= 0 && client.Class() != class {
+			continue
+		}
+		if skipMe && client == c {
+			continue
+		}
+		h.killClient(c, client)
+		killed++
+	}
+	return reply.MakeIntReply(int64(killed))
+}
+
+// 断开客户端，断开自己时先发送回复再断开
+func (h *RespHandler) killClient(self *connection.Connection, client *connection.Connection) {
+	if client == self {
+		client.SetCloseAfterReply()
+		return
+	}
+	client.Kill()
+}
+
+// CLIENT PAUSE timeout [WRITE|ALL]
+func (h *RespHandler) execClientPause(args [][]byte) resp.Reply {
+	if len(args) != 1 && len(args) != 2 {
+		return reply.MakeArgNumErrReply("client|pause")
+	}
+	timeout, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil || timeout < 0 {
+		return reply.MakeErrReply("ERR timeout is not an integer or out of range")
+	}
+	mode := pauseAll
+	if len(args) == 2 {
+		switch strings.ToLower(string(args[1])) {
+		case "write":
+			mode = pauseWrite
+		case "all":
+			mode = pauseAll
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	h.paused.pause(mode, time.Now().Add(time.Duration(timeout)*time.Millisecond))
+	return reply.MakeOkReply()
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"GoRedis/config"
+	"GoRedis/lib/logger"
+	"time"
+)
+
+// 客户端数量上限，没有配置时使用默认值
+func maxClients() int {
+	if config.Properties().MaxClients > 0 {
+		return config.Properties().MaxClients
+	}
+	return config.DefaultMaxClients
+}
+
+// 定时任务的执行间隔
+const cronInterval = 100 * time.Millisecond
+
+// 定时任务，每次都对每秒命令数采样，每秒检查一次空闲的客户端
+func (h *RespHandler) clientsCron() {
+	ticker := time.NewTicker(cronInterval)
+	defer ticker.Stop()
+	loops := 0
+	for {
+		select {
+		case <-h.stopCron:
+			return
+		case <-ticker.C:
+			h.stats.sampleOps()
+			loops++
+			if loops%int(time.Second/cronInterval) == 0 {
+				h.closeTimedOutClients()
+			}
+		}
+	}
+}
+
+// 订阅了频道或模式的客户端和监视器只接收消息，不会因为空闲而断开
+func (h *RespHandler) closeTimedOutClients() {
+	timeout := time.Duration(config.Properties().Timeout) * time.Second
+	if timeout <= 0 {
+		return
+	}
+	for _, client := range h.clients() {
+		if client.SubsCount() > 0 || client.IsMonitor() {
+			continue
+		}
+		if client.IdleTime() > timeout {
+			logger.With("addr", client.RemoteAddr().String()).Verbose("closing idle client")
+			client.Kill()
+		}
+	}
+}
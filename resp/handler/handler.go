@@ -5,8 +5,10 @@ package handler
  */
 
 import (
+	"GoRedis/config"
 	"GoRedis/database"
 	databaseface "GoRedis/interface/database"
+	"GoRedis/interface/resp"
 	"GoRedis/lib/logger"
 	"GoRedis/lib/sync/atomic"
 	"GoRedis/resp/connection"
@@ -20,7 +22,8 @@ import (
 )
 
 var (
-	unknownErrReplyBytes = []byte("-ERR unknown\r\n")
+	unknownErrReplyBytes    = []byte("-ERR unknown\r\n")
+	maxClientsErrReplyBytes = []byte("-ERR max number of clients reached\r\n")
 )
 
 // RespHandler 实现 tcp.Handler 并充当 redis 处理程序
@@ -28,14 +31,44 @@ type RespHandler struct {
 	activeConn sync.Map
 	db         databaseface.Database
 	closing    atomic.Boolean
+	// CLIENT PAUSE 的状态
+	paused pauseState
+	// 当前连接的客户端数量
+	clientCount atomic.Int64
+	// 关闭定时任务
+	stopCron     chan struct{}
+	stopCronOnce sync.Once
+	// 正在执行的命令数量
+	inFlight atomic.Int64
+	// INFO 命令使用的统计信息
+	stats handlerStats
+	// SHUTDOWN 的状态
+	shutdown shutdownState
+	// 服务器关闭之后关闭
+	done chan struct{}
 }
 
 func MakeHandler() *RespHandler {
-	var db databaseface.Database
-	db = database.NewStandaloneDatabase()
-	return &RespHandler{
-		db: db,
+	if limits := config.Properties().ClientOutputBufferLimit; limits != "" {
+		// 配置在解析时已经检查过
+		if err := connection.SetOutputBufferLimits(limits); err != nil {
+			panic(err)
+		}
+		// 配置文件中可以只给出部分类型，保存合并之后的完整限制
+		p := *config.Properties()
+		p.ClientOutputBufferLimit = connection.GetOutputBufferLimits()
+		config.SetProperties(&p)
+	}
+	sdb := database.NewStandaloneDatabase()
+	h := &RespHandler{
+		db:       sdb,
+		stopCron: make(chan struct{}),
+		done:     make(chan struct{}),
 	}
+	sdb.SetStatsFunc(h.getStats)
+	sdb.SetResetStatsFunc(h.stats.reset)
+	go h.clientsCron()
+	return h
 }
 
 // 关闭一个客户端的连接
@@ -50,10 +83,20 @@ func (h *RespHandler) Handle(ctx context.Context, conn net.Conn) {
 	if h.closing.Get() {
 		// 关闭处理程序拒绝新连接
 		_ = conn.Close()
+		return
+	}
+	// 超过 maxclients 时回复错误并关闭连接
+	defer h.clientCount.Add(-1)
+	if h.clientCount.Add(1) > int64(maxClients()) {
+		h.stats.rejectedConnections.Add(1)
+		_, _ = conn.Write(maxClientsErrReplyBytes)
+		_ = conn.Close()
+		return
 	}
 
 	client := connection.NewConn(conn)
 	h.activeConn.Store(client, 1)
+	h.stats.totalConnections.Add(1)
 
 	// 程序会为每一个客户端创建一个协程来解析
 	ch := parser.ParseStream(conn)
@@ -70,16 +113,16 @@ func (h *RespHandler) Handle(ctx context.Context, conn net.Conn) {
 				strings.Contains(payload.Err.Error(), "use of closed network connection") {
 				// 直接关闭客户端
 				h.closeClient(client)
-				logger.Info("connection closed: " + client.RemoteAddr().String())
+				logger.With("addr", client.RemoteAddr().String()).Verbose("connection closed")
 				return
 			}
 			// 协议错误
 			errReply := reply.MakeErrReply(payload.Err.Error())
 			// 将错误写回给客户端
-			err := client.Write(errReply.ToBytes())
+			err := writeReply(client, errReply.ToBytes(), len(ch) > 0)
 			if err != nil {
 				h.closeClient(client)
-				logger.Info("connection closed: " + client.RemoteAddr().String())
+				logger.With("addr", client.RemoteAddr().String()).Verbose("connection closed")
 				return
 			}
 			// 继续监听通道
@@ -87,35 +130,114 @@ func (h *RespHandler) Handle(ctx context.Context, conn net.Conn) {
 		}
 		// 获取的消息为空
 		if payload.Data == nil {
-			logger.Error("empty payload")
+			logger.With("addr", client.RemoteAddr().String()).Error("empty payload")
+			// 流水线已经结束，发送缓冲区中的回复
+			if len(ch) == 0 {
+				_ = client.Flush()
+			}
 			continue
 		}
 		// Data只是一个接口，需要转化为二维字节数组
 		r, ok := payload.Data.(*reply.MultiBulkReply)
-		if !ok {
-			logger.Error("require multi bulk reply")
+		if !ok || len(r.Args) == 0 {
+			logger.With("addr", client.RemoteAddr().String()).Error("require multi bulk reply")
+			// 流水线已经结束，发送缓冲区中的回复
+			if len(ch) == 0 {
+				_ = client.Flush()
+			}
+			continue
+		}
+		cmdName := strings.ToLower(string(r.Args[0]))
+		// 回复OK后关闭连接
+		if cmdName == "quit" {
+			_ = client.Write(reply.MakeOkReply().ToBytes())
+			h.quit(client, ch)
+			return
+		}
+		// 协议层执行的命令不经过 Exec，同样需要认证
+		if cmdName == "shutdown" || cmdName == "client" {
+			if errReply := h.db.CheckAuth(client, cmdName); errReply != nil {
+				_ = client.Write(reply.Encode(errReply, client.GetProtocol()))
+				continue
+			}
+		}
+		// 关闭服务器，成功时直接断开连接
+		if cmdName == "shutdown" {
+			result := h.execShutdown(r.Args[1:])
+			if result == nil {
+				h.quit(client, ch)
+				return
+			}
+			_ = client.Write(reply.Encode(result, client.GetProtocol()))
 			continue
 		}
+		// 执行 CLIENT PAUSE 或者服务器正在关闭时暂停执行命令
+		if !h.beginCommand(cmdName) {
+			h.quit(client, ch)
+			return
+		}
+		client.BeforeCommand(cmdName)
 		// 执行命令
-		result := h.db.Exec(client, r.Args)
-		if result != nil {
-			_ = client.Write(result.ToBytes())
+		var result resp.Reply
+		if cmdName == "client" {
+			result = h.execClient(client, r.Args[1:])
+		} else {
+			result = h.db.Exec(client, r.Args)
+		}
+		h.endCommand()
+		h.stats.totalCommands.Add(1)
+		// 通道中还有解析好的命令，说明客户端在使用流水线，回复先写入缓冲区
+		pipelined := len(ch) > 0
+		// CLIENT REPLY OFF 或者 SKIP 时不回复
+		if !client.ShouldReply() {
+			if !pipelined {
+				_ = client.Flush()
+			}
+		} else if result != nil {
+			_ = writeReply(client, reply.Encode(result, client.GetProtocol()), pipelined)
 			// 结果为空，只能是未知错误
 		} else {
-			_ = client.Write(unknownErrReplyBytes)
+			_ = writeReply(client, unknownErrReplyBytes, pipelined)
+		}
+		client.AfterCommand()
+		// CLIENT KILL 断开了自己
+		if client.CloseAfterReply() {
+			_ = client.Flush()
+			h.quit(client, ch)
+			return
 		}
 	}
+	// 解析器遇到无法恢复的协议错误时会关闭通道，此时关闭客户端
+	h.closeClient(client)
+	logger.With("addr", client.RemoteAddr().String()).Verbose("connection closed")
 }
 
-// Close 关闭整个协议层
+// 关闭客户端并丢弃还没有执行的命令
+func (h *RespHandler) quit(client *connection.Connection, ch <-chan *parser.Payload) {
+	h.closeClient(client)
+	logger.With("addr", client.RemoteAddr().String()).Verbose("connection closed")
+	// 解析协程读到连接关闭的错误后才会退出，需要把剩下的消息取完
+	go func() {
+		for range ch {
+		}
+	}()
+}
+
+// 写回复，流水线中的回复先写入缓冲区，流水线结束时再一起发送
+func writeReply(client *connection.Connection, b []byte, pipelined bool) error {
+	if pipelined {
+		return client.WriteBuffered(b)
+	}
+	return client.Write(b)
+}
+
+// Close 关闭整个协议层，和 SHUTDOWN FORCE 执行同样的流程
 func (h *RespHandler) Close() error {
 	logger.Info("handler shutting down...")
-	h.closing.Set(true)
-	h.activeConn.Range(func(key interface{}, val interface{}) bool {
-		client := key.(*connection.Connection)
-		_ = client.Close()
-		return true
-	})
-	h.db.Close()
-	return nil
+	return h.shutdownServer(shutdownFlags{force: true})
+}
+
+// Done 服务器关闭之后返回的通道会被关闭
+func (h *RespHandler) Done() <-chan struct{} {
+	return h.done
 }
@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"GoRedis/database"
+	"sync"
+	"time"
+)
+
+/*
+ * 暂停客户端执行命令
+ * CLIENT PAUSE 按照时间暂停，服务器关闭时暂停所有写命令
+ */
+
+// CLIENT PAUSE 暂停的命令类型
+const (
+	pauseWrite = iota + 1
+	pauseAll
+)
+
+// 暂停客户端的状态
+type pauseState struct {
+	mu sync.Mutex
+	// CLIENT PAUSE 暂停的命令类型，0表示没有暂停
+	mode int
+	// CLIENT PAUSE 结束的时间
+	end time.Time
+	// 服务器正在关闭，暂停所有写命令
+	shutdown bool
+	// 服务器已经关闭，不再执行任何命令
+	stopped bool
+	// 暂停解除时关闭，唤醒等待的客户端
+	changed chan struct{}
+}
+
+// 唤醒等待的客户端，调用者需要持有p.mu
+func (p *pauseState) notify() {
+	if p.changed != nil {
+		close(p.changed)
+		p.changed = nil
+	}
+}
+
+// 暂停客户端执行命令，直到超时或者执行 CLIENT UNPAUSE
+// 已经暂停时取更严格的模式和更晚的结束时间
+func (p *pauseState) pause(mode int, end time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if mode > p.mode {
+		p.mode = mode
+	}
+	if end.After(p.end) {
+		p.end = end
+	}
+}
+
+// 结束 CLIENT PAUSE
+func (p *pauseState) unpause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.mode = 0
+	p.end = time.Time{}
+	p.notify()
+}
+
+// 服务器开始关闭时暂停写命令，取消关闭时恢复
+func (p *pauseState) setShutdown(shutdown bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.shutdown = shutdown
+	if !shutdown {
+		p.notify()
+	}
+}
+
+// 服务器已经关闭，唤醒所有等待的客户端
+func (p *pauseState) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stopped = true
+	p.notify()
+}
+
+// 判断命令是否被暂停
+func (p *pauseState) isPaused(cmdName string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pausedLocked(cmdName)
+}
+
+// 调用者需要持有p.mu
+// CLIENT 命令不会被 CLIENT PAUSE 暂停，保证可以执行 CLIENT UNPAUSE
+func (p *pauseState) pausedLocked(cmdName string) bool {
+	if p.stopped {
+		return true
+	}
+	write := database.IsWriteCommand(cmdName)
+	if p.shutdown && write {
+		return true
+	}
+	if p.mode == 0 || cmdName == "client" {
+		return false
+	}
+	// 暂停已经超时
+	if !time.Now().Before(p.end) {
+		p.mode = 0
+		p.end = time.Time{}
+		p.notify()
+		return false
+	}
+	return p.mode == pauseAll || write
+}
+
+// 如果命令被暂停就阻塞，直到暂停结束
+// 服务器已经关闭时返回false，命令不能再执行
+func (p *pauseState) wait(cmdName string) bool {
+	for {
+		p.mu.Lock()
+		if p.stopped {
+			p.mu.Unlock()
+			return false
+		}
+		if !p.pausedLocked(cmdName) {
+			p.mu.Unlock()
+			return true
+		}
+		if p.changed == nil {
+			p.changed = make(chan struct{})
+		}
+		changed := p.changed
+		// CLIENT PAUSE 到时间之后自动结束
+		var timeout <-chan time.Time
+		var timer *time.Timer
+		if p.mode != 0 {
+			timer = time.NewTimer(time.Until(p.end))
+			timeout = timer.C
+		}
+		p.mu.Unlock()
+
+		select {
+		case <-timeout:
+		case <-changed:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// 开始执行命令，命令被暂停时阻塞
+// 正在执行的命令会被计数，服务器关闭前等待这些命令执行完毕
+// 服务器已经关闭时返回false
+func (h *RespHandler) beginCommand(cmdName string) bool {
+	for {
+		h.inFlight.Add(1)
+		if !h.paused.isPaused(cmdName) {
+			return true
+		}
+		h.inFlight.Add(-1)
+		h.stats.blockedClients.Add(1)
+		ok := h.paused.wait(cmdName)
+		h.stats.blockedClients.Add(-1)
+		if !ok {
+			return false
+		}
+	}
+}
+
+// 命令执行完毕
+func (h *RespHandler) endCommand() {
+	h.inFlight.Add(-1)
+}
@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"GoRedis/interface/resp"
+	"GoRedis/lib/logger"
+	"GoRedis/resp/connection"
+	"GoRedis/resp/reply"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ * SHUTDOWN 命令和服务器的关闭流程
+ * 1. 拒绝新的连接，暂停所有写命令
+ * 2. 等待正在执行的命令执行完毕，可以被 SHUTDOWN ABORT 取消
+ * 3. 将AOF缓冲的指令写入文件并fsync
+ * 4. 关闭所有客户端和AOF文件，通知TCP服务器退出
+ * 收到 SIGTERM 或 SIGINT 时也执行同样的流程
+ */
+
+// 等待正在执行的命令的最长时间
+const shutdownTimeout = 10 * time.Second
+
+var errShutdownFailed = errors.New("ERR Errors trying to SHUTDOWN. Check logs.")
+
+// SHUTDOWN 的选项
+type shutdownFlags struct {
+	// 生成快照
+	save bool
+	// 不生成快照
+	noSave bool
+	// 不等待正在执行的命令
+	now bool
+	// 持久化出错时也关闭
+	force bool
+}
+
+// 关闭流程的状态
+type shutdownState struct {
+	mu sync.Mutex
+	// 正在等待正在执行的命令，可以被 SHUTDOWN ABORT 取消
+	inProgress bool
+	// 取消关闭时关闭
+	abort chan struct{}
+	// 已经关闭
+	done bool
+}
+
+// SHUTDOWN [NOSAVE|SAVE] [NOW] [FORCE] [ABORT]
+// 关闭成功时返回nil，客户端的连接直接断开
+func (h *RespHandler) execShutdown(args [][]byte) resp.Reply {
+	var flags shutdownFlags
+	abort := false
+	for _, arg := range args {
+		switch strings.ToLower(string(arg)) {
+		case "nosave":
+			flags.noSave = true
+		case "save":
+			flags.save = true
+		case "now":
+			flags.now = true
+		case "force":
+			flags.force = true
+		case "abort":
+			abort = true
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	if flags.save && flags.noSave {
+		return reply.MakeSyntaxErrReply()
+	}
+	if abort {
+		if len(args) != 1 {
+			return reply.MakeSyntaxErrReply()
+		}
+		return h.abortShutdown()
+	}
+	logger.Info("User requested shutdown...")
+	if err := h.shutdownServer(flags); err != nil {
+		return reply.MakeErrReply(err.Error())
+	}
+	return nil
+}
+
+// SHUTDOWN ABORT 取消正在等待的关闭流程
+func (h *RespHandler) abortShutdown() resp.Reply {
+	s := &h.shutdown
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.inProgress || s.abort == nil {
+		return reply.MakeErrReply("ERR No shutdown in progress.")
+	}
+	close(s.abort)
+	s.abort = nil
+	return reply.MakeOkReply()
+}
+
+// 执行关闭流程，出错或者被取消时服务器继续运行
+func (h *RespHandler) shutdownServer(flags shutdownFlags) error {
+	s := &h.shutdown
+	s.mu.Lock()
+	if s.done {
+		s.mu.Unlock()
+		return nil
+	}
+	if s.inProgress {
+		s.mu.Unlock()
+		return errors.New("ERR shutdown already in progress")
+	}
+	s.inProgress = true
+	abort := make(chan struct{})
+	s.abort = abort
+	s.mu.Unlock()
+
+	// 拒绝新的连接，暂停写命令
+	h.closing.Set(true)
+	h.paused.setShutdown(true)
+
+	// 等待正在执行的命令
+	if !flags.now && !h.waitInFlight(abort) {
+		logger.Warn("shutdown aborted")
+		h.cancelShutdown()
+		return errShutdownFailed
+	}
+
+	// 持久化数据
+	if err := h.db.PrepareShutdown(flags.save); err != nil {
+		if !flags.force {
+			logger.Warn("errors trying to shut down the server, check the logs for more information")
+			h.cancelShutdown()
+			return errShutdownFailed
+		}
+		logger.Warn("errors persisting data, exiting anyway because of FORCE")
+	}
+
+	s.mu.Lock()
+	s.inProgress = false
+	s.abort = nil
+	s.done = true
+	s.mu.Unlock()
+	h.finishShutdown()
+	return nil
+}
+
+// 等待正在执行的命令执行完毕，被取消时返回false
+func (h *RespHandler) waitInFlight(abort <-chan struct{}) bool {
+	if h.inFlight.Get() == 0 {
+		return true
+	}
+	logger.Info("waiting for in-flight commands to finish...")
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.NewTimer(shutdownTimeout)
+	defer deadline.Stop()
+	for h.inFlight.Get() > 0 {
+		select {
+		case <-abort:
+			return false
+		case <-deadline.C:
+			logger.Warn("in-flight commands didn't finish in time, shutting down anyway")
+			return true
+		case <-ticker.C:
+		}
+	}
+	return true
+}
+
+// 取消关闭，恢复接收连接和执行写命令
+func (h *RespHandler) cancelShutdown() {
+	h.paused.setShutdown(false)
+	h.closing.Set(false)
+	s := &h.shutdown
+	s.mu.Lock()
+	s.inProgress = false
+	s.abort = nil
+	s.mu.Unlock()
+}
+
+// 关闭所有客户端和数据库，通知TCP服务器退出
+func (h *RespHandler) finishShutdown() {
+	h.paused.stop()
+	h.stopCronOnce.Do(func() {
+		close(h.stopCron)
+	})
+	// 同时关闭所有客户端，每个客户端发送剩余回复的等待时间不会累加
+	var wg sync.WaitGroup
+	h.activeConn.Range(func(key interface{}, val interface{}) bool {
+		client := key.(*connection.Connection)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = client.Close()
+		}()
+		return true
+	})
+	wg.Wait()
+	h.db.Close()
+	close(h.done)
+	logger.Info("GoRedis is now ready to exit, bye bye...")
+}
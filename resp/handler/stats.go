@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"GoRedis/database"
+	"GoRedis/lib/metrics"
+	"GoRedis/lib/sync/atomic"
+	"sync"
+	"time"
+)
+
+// 计算每秒命令数使用的采样个数，和Redis一致
+const opsSamples = 16
+
+// 协议层的统计信息
+type handlerStats struct {
+	// 接收过的连接总数
+	totalConnections atomic.Int64
+	// 因为 maxclients 被拒绝的连接数
+	rejectedConnections atomic.Int64
+	// 执行过的命令总数
+	totalCommands atomic.Int64
+	// 被暂停的客户端数量
+	blockedClients atomic.Int64
+
+	// 每秒命令数的采样
+	mu sync.Mutex
+	// 上一次采样的时间和命令总数
+	lastSampleTime     time.Time
+	lastSampleCommands int64
+	samples            [opsSamples]int64
+	sampleIndex        int
+}
+
+// 记录一次每秒命令数的采样，由定时任务调用
+func (s *handlerStats) sampleOps() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	commands := s.totalCommands.Get()
+	if !s.lastSampleTime.IsZero() {
+		elapsed := now.Sub(s.lastSampleTime)
+		if elapsed > 0 {
+			ops := (commands - s.lastSampleCommands) * int64(time.Second) / int64(elapsed)
+			s.samples[s.sampleIndex] = ops
+			s.sampleIndex = (s.sampleIndex + 1) % opsSamples
+		}
+	}
+	s.lastSampleTime = now
+	s.lastSampleCommands = commands
+}
+
+// 返回所有采样的平均值
+func (s *handlerStats) opsPerSec() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sum int64
+	for _, ops := range s.samples {
+		sum += ops
+	}
+	return sum / opsSamples
+}
+
+// 清空累计的统计信息，用于 CONFIG RESETSTAT
+func (s *handlerStats) reset() {
+	s.totalConnections.Set(0)
+	s.rejectedConnections.Set(0)
+	s.totalCommands.Set(0)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastSampleTime = time.Time{}
+	s.lastSampleCommands = 0
+	s.samples = [opsSamples]int64{}
+	s.sampleIndex = 0
+}
+
+// 返回 INFO 命令使用的统计信息
+func (h *RespHandler) getStats() database.HandlerStats {
+	return database.HandlerStats{
+		ConnectedClients:    len(h.clients()),
+		BlockedClients:      int(h.stats.blockedClients.Get()),
+		TotalConnections:    h.stats.totalConnections.Get(),
+		RejectedConnections: h.stats.rejectedConnections.Get(),
+		TotalCommands:       h.stats.totalCommands.Get(),
+		OpsPerSec:           h.stats.opsPerSec(),
+	}
+}
+
+// Collect 输出 Prometheus 指标，数据库的指标由数据库输出
+func (h *RespHandler) Collect(w *metrics.Writer) {
+	if collector, ok := h.db.(metrics.Collector); ok {
+		collector.Collect(w)
+	}
+}
@@ -0,0 +1,173 @@
+package parser
+
+import (
+	"bufio"
+	"errors"
+)
+
+/*--- 内联命令 ---*/
+
+// 内联命令的最大长度，和Redis一样是64KB
+const maxInlineSize = 64 * 1024
+
+var (
+	errInlineTooBig     = errors.New("ERR Protocol error: too big inline request")
+	errUnbalancedQuotes = errors.New("ERR Protocol error: unbalanced quotes in request")
+)
+
+// 读取一行数据，超过limit还没有读到\n就返回错误
+func readLineWithLimit(bufReader *bufio.Reader, limit int) ([]byte, error) {
+	var line []byte
+	for {
+		frag, err := bufReader.ReadSlice('\n')
+		// ReadSlice返回的是缓冲区的引用，需要拷贝出来
+		line = append(line, frag...)
+		if len(line) > limit {
+			return nil, errInlineTooBig
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return line, nil
+	}
+}
+
+// 判断读到的行是不是内联命令
+// 正在解析多行命令时读到的都是命令体，其余情况下以 * $ + - : 开头的是RESP协议
+func isInline(msg []byte, state *readState) bool {
+	if state.readingMultiLine || len(msg) == 0 {
+		return false
+	}
+	switch msg[0] {
+	case '*', '$', '+', '-', ':':
+		return false
+	}
+	return true
+}
+
+// 去掉行尾的\r\n或者\n
+func trimLineEnd(msg []byte) []byte {
+	if len(msg) > 0 && msg[len(msg)-1] == '\n' {
+		msg = msg[:len(msg)-1]
+	}
+	if len(msg) > 0 && msg[len(msg)-1] == '\r' {
+		msg = msg[:len(msg)-1]
+	}
+	return msg
+}
+
+// 按照Redis的规则切分内联命令：空白分隔，支持双引号、单引号和转义
+func parseInline(msg []byte) ([][]byte, error) {
+	line := trimLineEnd(msg)
+	args := make([][]byte, 0)
+	i := 0
+	for {
+		// 跳过空白
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		if i >= len(line) {
+			return args, nil
+		}
+		var arg []byte
+		inDoubleQuotes := false
+		inSingleQuotes := false
+		done := false
+		for !done {
+			if inDoubleQuotes {
+				if i >= len(line) {
+					return nil, errUnbalancedQuotes
+				}
+				c := line[i]
+				if c == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHexDigit(line[i+2]) && isHexDigit(line[i+3]) {
+					arg = append(arg, hexDigitToInt(line[i+2])*16+hexDigitToInt(line[i+3]))
+					i += 3
+				} else if c == '\\' && i+1 < len(line) {
+					i++
+					switch line[i] {
+					case 'n':
+						arg = append(arg, '\n')
+					case 'r':
+						arg = append(arg, '\r')
+					case 't':
+						arg = append(arg, '\t')
+					case 'b':
+						arg = append(arg, '\b')
+					case 'a':
+						arg = append(arg, '\a')
+					default:
+						arg = append(arg, line[i])
+					}
+				} else if c == '"' {
+					// 右引号后面必须是空白或者行尾
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, errUnbalancedQuotes
+					}
+					done = true
+				} else {
+					arg = append(arg, c)
+				}
+			} else if inSingleQuotes {
+				if i >= len(line) {
+					return nil, errUnbalancedQuotes
+				}
+				c := line[i]
+				if c == '\\' && i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					arg = append(arg, '\'')
+				} else if c == '\'' {
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, errUnbalancedQuotes
+					}
+					done = true
+				} else {
+					arg = append(arg, c)
+				}
+			} else {
+				if i >= len(line) {
+					break
+				}
+				c := line[i]
+				switch {
+				case isSpace(c):
+					done = true
+				case c == '"':
+					inDoubleQuotes = true
+				case c == '\'':
+					inSingleQuotes = true
+				default:
+					arg = append(arg, c)
+				}
+			}
+			if i < len(line) {
+				i++
+			}
+		}
+		if arg == nil {
+			arg = []byte{}
+		}
+		args = append(args, arg)
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func hexDigitToInt(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
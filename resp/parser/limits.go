@@ -0,0 +1,92 @@
+package parser
+
+import (
+	"GoRedis/config"
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+/*--- 协议限制 ---*/
+
+// 默认限制，和Redis一致
+const (
+	defaultProtoMaxBulkLen      = 512 * 1024 * 1024
+	defaultProtoMaxMultiBulkLen = 1024 * 1024
+	defaultQueryBufferLimit     = 1024 * 1024 * 1024
+	// 超过这个长度的参数按照实际读到的数据逐步分配内存
+	bigArgSize = 32 * 1024
+)
+
+var (
+	errInvalidMultiBulkLength = errors.New("ERR Protocol error: invalid multibulk length")
+	errInvalidBulkLength      = errors.New("ERR Protocol error: invalid bulk length")
+	errQueryBufferLimit       = errors.New("ERR Protocol error: client query buffer limit reached")
+)
+
+// 判断是否是无法恢复的协议错误
+// 出现这类错误时已经无法确定下一条命令从哪里开始，和Redis一样回复错误后关闭连接
+func isFatal(err error) bool {
+	return err == errInlineTooBig ||
+		err == errUnbalancedQuotes ||
+		err == errInvalidMultiBulkLength ||
+		err == errInvalidBulkLength ||
+		err == errQueryBufferLimit
+}
+
+// 发送错误并结束解析
+func sendFatal(ch chan<- *Payload, err error) {
+	ch <- &Payload{
+		Err: err,
+	}
+	close(ch)
+}
+
+// 单个参数的最大长度 proto-max-bulk-len
+func maxBulkLen() int64 {
+	if config.Properties().ProtoMaxBulkLen > 0 {
+		return int64(config.Properties().ProtoMaxBulkLen)
+	}
+	return defaultProtoMaxBulkLen
+}
+
+// 一条命令的最大参数个数 proto-max-multibulk-len
+func maxMultiBulkLen() int64 {
+	if config.Properties().ProtoMaxMultiBulkLen > 0 {
+		return int64(config.Properties().ProtoMaxMultiBulkLen)
+	}
+	return defaultProtoMaxMultiBulkLen
+}
+
+// 一条命令占用的最大字节数 client-query-buffer-limit
+func queryBufferLimit() int64 {
+	if config.Properties().ClientQueryBufferLimit > 0 {
+		return int64(config.Properties().ClientQueryBufferLimit)
+	}
+	return defaultQueryBufferLimit
+}
+
+// 累加当前命令已经读到的字节数，超过限制返回错误
+func (s *readState) addQueryLen(n int) error {
+	s.queryLen += int64(n)
+	if s.queryLen > queryBufferLimit() {
+		return errQueryBufferLimit
+	}
+	return nil
+}
+
+// 读取size个字节，大参数按照实际读到的数据分配内存，防止客户端声明一个很大的长度却不发送数据
+func readBulk(bufReader *bufio.Reader, size int64) ([]byte, error) {
+	if size <= bigArgSize {
+		msg := make([]byte, size)
+		_, err := io.ReadFull(bufReader, msg)
+		return msg, err
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, bigArgSize))
+	n, err := io.CopyN(buf, bufReader, size)
+	if err == io.EOF && n > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return buf.Bytes(), err
+}
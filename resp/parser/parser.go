@@ -6,6 +6,7 @@ import (
 	"GoRedis/resp/reply"
 	"bufio"
 	"errors"
+	"fmt"
 	"io"
 	"runtime/debug"
 	"strconv"
@@ -33,6 +34,10 @@ type readState struct {
 	args [][]byte
 	// 数据块的长度（$符号后面的数字）
 	bulkLen int64
+	// 下一次按照bulkLen读取参数本体，而不是读取一行
+	readingBulk bool
+	// 当前命令已经读到的字节数
+	queryLen int64
 }
 
 // 判断是否已经解析结束
@@ -40,9 +45,13 @@ func (s *readState) finished() bool {
 	return s.expectedArgsCount > 0 && len(s.args) == s.expectedArgsCount
 }
 
+// 解析好但还没有执行的命令最多缓存多少条
+// 流水线中后面的命令已经解析好时，业务层可以先缓存回复，最后一起发送
+const payloadBufferSize = 128
+
 // ParseStream 协议层对外提供的API
 func ParseStream(reader io.Reader) <-chan *Payload {
-	ch := make(chan *Payload)
+	ch := make(chan *Payload, payloadBufferSize)
 	// 异步解析命令
 	// 一个用户创建一个解析器
 	go parse0(reader, ch)
@@ -53,9 +62,10 @@ func ParseStream(reader io.Reader) <-chan *Payload {
 // 进行解析的函数
 func parse0(reader io.Reader, ch chan<- *Payload) {
 	defer func() {
-		// 防止循环中有错误直接退出
+		// 解析出现意外错误时和协议错误一样关闭通道，业务层才能结束这个连接
 		if err := recover(); err != nil {
 			logger.Error(string(debug.Stack()))
+			sendFatal(ch, fmt.Errorf("protocol error: %v", err))
 		}
 	}()
 	bufReader := bufio.NewReader(reader)
@@ -68,12 +78,9 @@ func parse0(reader io.Reader, ch chan<- *Payload) {
 		// 先读取一行的数据
 		msg, ioErr, err = readLine(bufReader, &state)
 		if err != nil {
-			// 出现IO错误
-			if ioErr {
-				ch <- &Payload{
-					Err: err,
-				}
-				close(ch)
+			// 出现IO错误，或者请求过大无法继续解析
+			if ioErr || isFatal(err) {
+				sendFatal(ch, err)
 				return
 			}
 			// 不是IO错误就是协议错误
@@ -94,6 +101,10 @@ func parse0(reader io.Reader, ch chan<- *Payload) {
 			if msg[0] == '*' {
 				// multi bulk reply
 				err = parseMultiBulkHeader(msg, &state)
+				if isFatal(err) {
+					sendFatal(ch, err)
+					return
+				}
 				if err != nil {
 					ch <- &Payload{
 						Err: errors.New("protocol error: " + string(msg)),
@@ -113,6 +124,10 @@ func parse0(reader io.Reader, ch chan<- *Payload) {
 				// $4\r\nPING\r\n
 			} else if msg[0] == '$' {
 				err = parseBulkHeader(msg, &state)
+				if isFatal(err) {
+					sendFatal(ch, err)
+					return
+				}
 				// 协议错误
 				if err != nil {
 					ch <- &Payload{
@@ -129,7 +144,7 @@ func parse0(reader io.Reader, ch chan<- *Payload) {
 					state = readState{}
 					continue
 				}
-			} else {
+			} else if msg[0] == '+' || msg[0] == '-' || msg[0] == ':' {
 				// 单行指令 一次就能解析完
 				result, err := parseSingleLineReply(msg)
 				ch <- &Payload{
@@ -138,14 +153,34 @@ func parse0(reader io.Reader, ch chan<- *Payload) {
 				}
 				state = readState{}
 				continue
+			} else {
+				// 内联命令，比如 telnet 中直接输入的 PING
+				args, err := parseInline(msg)
+				if err != nil {
+					// 引号不匹配，和Redis一样关闭连接
+					sendFatal(ch, err)
+					return
+				}
+				// 空行直接忽略
+				if len(args) > 0 {
+					ch <- &Payload{
+						Data: reply.MakeMultiBulkReply(args),
+					}
+				}
+				state = readState{}
+				continue
 			}
 		} else {
 			// 解析多行命令的命令体
 			err = readBody(msg, &state)
+			if isFatal(err) {
+				sendFatal(ch, err)
+				return
+			}
 			// 协议错误
 			if err != nil {
 				ch <- &Payload{
-					Err: errors.New("protocol error: " + string(msg)),
+					Err: err,
 				}
 				state = readState{} // reset state
 				continue
@@ -179,17 +214,29 @@ func readLine(bufReader *bufio.Reader, state *readState) ([]byte, bool, error) {
 	var msg []byte
 	var err error
 	// 1.依照\r\n切分
-	if state.bulkLen == 0 {
-		msg, err = bufReader.ReadBytes('\n')
+	if !state.readingBulk {
+		msg, err = readLineWithLimit(bufReader, maxInlineSize)
+		if err == errInlineTooBig {
+			return nil, false, err
+		}
 		if err != nil {
 			return nil, true, err
 		}
-		if len(msg) == 0 || msg[len(msg)-2] != '\r' {
-			return nil, false, errors.New("protocol error: " + string(msg))
+		// 内联命令可以只用\n结尾，其余的行必须以\r\n结尾
+		if !isInline(msg, state) {
+			if len(msg) < 2 || msg[len(msg)-2] != '\r' {
+				return nil, false, errors.New("protocol error: " + string(msg))
+			}
+		}
+		if err = state.addQueryLen(len(msg)); err != nil {
+			return nil, false, err
 		}
 	} else { // 2.依照$符号后面的数字切分
-		msg = make([]byte, state.bulkLen+2)
-		_, err = io.ReadFull(bufReader, msg)
+		// 读取之前先检查，超过限制就不再读取
+		if err = state.addQueryLen(int(state.bulkLen + 2)); err != nil {
+			return nil, false, err
+		}
+		msg, err = readBulk(bufReader, state.bulkLen+2)
 		if err != nil {
 			return nil, true, err
 		}
@@ -198,7 +245,6 @@ func readLine(bufReader *bufio.Reader, state *readState) ([]byte, bool, error) {
 			msg[len(msg)-1] != '\n' {
 			return nil, false, errors.New("protocol error: " + string(msg))
 		}
-		state.bulkLen = 0
 	}
 	return msg, false, nil
 }
@@ -212,6 +258,9 @@ func parseMultiBulkHeader(msg []byte, state *readState) error {
 	if err != nil {
 		return errors.New("protocol error: " + string(msg))
 	}
+	if int64(expectedLine) > maxMultiBulkLen() {
+		return errInvalidMultiBulkLength
+	}
 	if expectedLine == 0 {
 		state.expectedArgsCount = 0
 		return nil
@@ -220,7 +269,12 @@ func parseMultiBulkHeader(msg []byte, state *readState) error {
 		state.msgType = msg[0]
 		state.readingMultiLine = true
 		state.expectedArgsCount = int(expectedLine)
-		state.args = make([][]byte, 0, expectedLine)
+		// 参数个数是客户端声明的，不能完全信任，预分配的容量设置上限
+		capacity := expectedLine
+		if capacity > 1024 {
+			capacity = 1024
+		}
+		state.args = make([][]byte, 0, capacity)
 		return nil
 	} else {
 		return errors.New("protocol error: " + string(msg))
@@ -236,11 +290,16 @@ func parseBulkHeader(msg []byte, state *readState) error {
 	if err != nil {
 		return errors.New("protocol error: " + string(msg))
 	}
+	if state.bulkLen > maxBulkLen() {
+		return errInvalidBulkLength
+	}
 	if state.bulkLen == -1 {
 		return nil
-	} else if state.bulkLen > 0 {
+	} else if state.bulkLen >= 0 {
+		// $0\r\n\r\n 是空字符串，同样需要读取后面的\r\n
 		state.msgType = msg[0]
 		state.readingMultiLine = true
+		state.readingBulk = true
 		state.expectedArgsCount = 1
 		state.args = make([][]byte, 0, 1)
 		return nil
@@ -274,21 +333,30 @@ func parseSingleLineReply(msg []byte) (resp.Reply, error) {
 // 解析命令本体
 func readBody(msg []byte, state *readState) error {
 	line := msg[0 : len(msg)-2]
-	var err error
-	// 如果读到的是bulkLen，就设置bulkLen
-	if line[0] == '$' {
-		// bulk reply
-		state.bulkLen, err = strconv.ParseInt(string(line[1:]), 10, 64)
-		if err != nil {
-			return errors.New("protocol error: " + string(msg))
-		}
-		if state.bulkLen <= 0 { // null bulk in multi bulks
-			state.args = append(state.args, []byte{})
-			state.bulkLen = 0
-		}
-	} else {
-		// 读到的是命令本体
+	// 读到的是按照bulkLen读取的参数本体，长度为0时是空字符串
+	if state.readingBulk {
 		state.args = append(state.args, line)
+		state.readingBulk = false
+		state.bulkLen = 0
+		return nil
+	}
+	// 否则必须是$开头的参数长度，错误信息中不能带有\r\n
+	if len(line) == 0 || line[0] != '$' {
+		return errors.New("protocol error: expected '$', got '" + string(line) + "'")
+	}
+	bulkLen, err := strconv.ParseInt(string(line[1:]), 10, 64)
+	if err != nil || bulkLen < -1 {
+		return errors.New("protocol error: invalid bulk length " + string(line))
+	}
+	if bulkLen > maxBulkLen() {
+		return errInvalidBulkLength
+	}
+	// 只有$-1是空值
+	if bulkLen == -1 {
+		state.args = append(state.args, nil)
+		return nil
 	}
+	state.bulkLen = bulkLen
+	state.readingBulk = true
 	return nil
 }
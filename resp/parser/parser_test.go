@@ -0,0 +1,142 @@
+package parser
+
+import (
+	"GoRedis/resp/reply"
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 解析全部输入，输入结束时解析器发送最后一个错误并关闭通道
+// 返回之前解析出的结果，以及最后的错误，正常读到结尾时错误为nil
+func parseAll(t *testing.T, input string) ([]*Payload, error) {
+	t.Helper()
+	ch := ParseStream(bytes.NewReader([]byte(input)))
+	payloads := make([]*Payload, 0)
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case p, ok := <-ch:
+			if ok {
+				payloads = append(payloads, p)
+				continue
+			}
+			if len(payloads) == 0 || payloads[len(payloads)-1].Err == nil {
+				t.Fatalf("%q: channel closed without an error", input)
+			}
+			last := payloads[len(payloads)-1]
+			payloads = payloads[:len(payloads)-1]
+			if last.Err == io.EOF {
+				return payloads, nil
+			}
+			return payloads, last.Err
+		case <-timeout:
+			t.Fatalf("%q: parser did not close the channel", input)
+		}
+	}
+}
+
+func multiBulk(args ...string) *reply.MultiBulkReply {
+	lines := make([][]byte, len(args))
+	for i, arg := range args {
+		lines[i] = []byte(arg)
+	}
+	return reply.MakeMultiBulkReply(lines)
+}
+
+func TestParseEmptyBulkInMultiBulk(t *testing.T) {
+	input := "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$0\r\n\r\n*1\r\n$4\r\nPING\r\n"
+	payloads, err := parseAll(t, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payloads) != 2 {
+		t.Fatalf("got %d payloads, want 2", len(payloads))
+	}
+	for i, want := range []*reply.MultiBulkReply{multiBulk("SET", "k", ""), multiBulk("PING")} {
+		if payloads[i].Err != nil {
+			t.Fatalf("payload %d: unexpected error %v", i, payloads[i].Err)
+		}
+		got, ok := payloads[i].Data.(*reply.MultiBulkReply)
+		if !ok || !bytes.Equal(got.ToBytes(), want.ToBytes()) {
+			t.Errorf("payload %d = %q, want %q", i, payloads[i].Data.ToBytes(), want.ToBytes())
+		}
+	}
+	// 空字符串不是空值
+	args := payloads[0].Data.(*reply.MultiBulkReply).Args
+	if args[2] == nil || len(args[2]) != 0 {
+		t.Errorf("empty bulk parsed as %#v", args[2])
+	}
+}
+
+func TestParseBulk(t *testing.T) {
+	payloads, err := parseAll(t, "$0\r\n\r\n$-1\r\n$5\r\nhello\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"$0\r\n\r\n", "$-1\r\n", "$5\r\nhello\r\n"}
+	if len(payloads) != len(want) {
+		t.Fatalf("got %d payloads, want %d", len(payloads), len(want))
+	}
+	for i, p := range payloads {
+		if p.Err != nil || string(p.Data.ToBytes()) != want[i] {
+			t.Errorf("payload %d = %v, %v, want %q", i, p.Data, p.Err, want[i])
+		}
+	}
+}
+
+func TestParseNullBulkInMultiBulk(t *testing.T) {
+	payloads, err := parseAll(t, "*2\r\n$-1\r\n$1\r\na\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payloads) != 1 || payloads[0].Err != nil {
+		t.Fatalf("unexpected payloads %v", payloads)
+	}
+	args := payloads[0].Data.(*reply.MultiBulkReply).Args
+	if !reflect.DeepEqual(args, [][]byte{nil, []byte("a")}) {
+		t.Errorf("args = %#v", args)
+	}
+}
+
+func TestParseProtocolErrors(t *testing.T) {
+	inputs := []string{
+		// 参数长度的位置是空行
+		"*2\r\n\r\n$1\r\na\r\n",
+		// 参数长度不是$开头
+		"*1\r\nPING\r\n",
+		"*1\r\n$-2\r\n",
+		"*1\r\n$abc\r\n",
+		// 参数本体后面不是\r\n
+		"*1\r\n$1\r\nab\r\n",
+		"*1\r\n$0\r\nxx",
+	}
+	for _, input := range inputs {
+		payloads, _ := parseAll(t, input)
+		found := false
+		for _, p := range payloads {
+			if p.Err != nil && strings.Contains(p.Err.Error(), "protocol error") {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%q: expected a protocol error, got %v", input, payloads)
+		}
+	}
+}
+
+func TestParseAfterProtocolError(t *testing.T) {
+	payloads, err := parseAll(t, "*1\r\n\r\n*1\r\n$4\r\nPING\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payloads) != 2 || payloads[0].Err == nil {
+		t.Fatalf("unexpected payloads %v", payloads)
+	}
+	if got := payloads[1].Data; got == nil || !bytes.Equal(got.ToBytes(), multiBulk("PING").ToBytes()) {
+		t.Errorf("command after the protocol error = %v", got)
+	}
+}
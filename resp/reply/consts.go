@@ -47,7 +47,7 @@ func MakeNullBulkReply() *NullBulkReply {
 // EmptyMultiBulkReply 空数组回复
 type EmptyMultiBulkReply struct{}
 
-var emptyMultiBulkBytes = []byte("*\r\n")
+var emptyMultiBulkBytes = []byte("*0\r\n")
 
 func (e EmptyMultiBulkReply) ToBytes() []byte {
 	return emptyMultiBulkBytes
@@ -20,8 +20,9 @@ type BulkReply struct {
 }
 
 func (b *BulkReply) ToBytes() []byte {
-	if len(b.Arg) == 0 {
-		return nullBulkReplyBytes
+	// 只有nil是空回复，空字符串编码为 $0\r\n\r\n
+	if b.Arg == nil {
+		return nullBulkBytes
 	}
 	// $7\r\nmessage\r\n
 	return []byte("$" + strconv.Itoa(len(b.Arg)) + CRLF + string(b.Arg) + CRLF)
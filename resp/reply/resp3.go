@@ -0,0 +1,238 @@
+package reply
+
+/*-- RESP3协议的回复 --*/
+
+// 每种回复的ToBytes都返回RESP2的编码，保证RESP2客户端的兼容性
+// 使用RESP3协议的客户端通过Encode获取ToResp3Bytes的编码
+
+import (
+	"GoRedis/interface/resp"
+	"bytes"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// 协议版本
+const (
+	Resp2 = 2
+	Resp3 = 3
+)
+
+// Resp3Reply 可以按照RESP3协议编码的回复
+type Resp3Reply interface {
+	resp.Reply
+	// ToResp3Bytes 转换为RESP3协议的字节
+	ToResp3Bytes() []byte
+}
+
+// Encode 根据客户端使用的协议版本编码回复
+func Encode(r resp.Reply, protocol int) []byte {
+	if protocol == Resp3 {
+		if r3, ok := r.(Resp3Reply); ok {
+			return r3.ToResp3Bytes()
+		}
+	}
+	return r.ToBytes()
+}
+
+// 编码聚合类型的回复，元素按照同一协议编码
+func encodeAggregate(prefix byte, size int, replies []resp.Reply, protocol int) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(prefix)
+	buf.WriteString(strconv.Itoa(size) + CRLF)
+	for _, r := range replies {
+		buf.Write(Encode(r, protocol))
+	}
+	return buf.Bytes()
+}
+
+// MapReply 键值对回复，RESP2中是键值交替排列的数组
+type MapReply struct {
+	// 键值交替排列
+	Args []resp.Reply
+}
+
+// MakeMapReply 创建键值对回复，args中键值交替排列
+func MakeMapReply(args []resp.Reply) *MapReply {
+	return &MapReply{Args: args}
+}
+
+func (r *MapReply) ToBytes() []byte {
+	return encodeAggregate('*', len(r.Args), r.Args, Resp2)
+}
+
+func (r *MapReply) ToResp3Bytes() []byte {
+	return encodeAggregate('%', len(r.Args)/2, r.Args, Resp3)
+}
+
+// SetReply 集合回复，RESP2中是数组
+type SetReply struct {
+	Members []resp.Reply
+}
+
+func MakeSetReply(members []resp.Reply) *SetReply {
+	return &SetReply{Members: members}
+}
+
+func (r *SetReply) ToBytes() []byte {
+	return encodeAggregate('*', len(r.Members), r.Members, Resp2)
+}
+
+func (r *SetReply) ToResp3Bytes() []byte {
+	return encodeAggregate('~', len(r.Members), r.Members, Resp3)
+}
+
+// PushReply 服务端主动推送的消息，比如发布订阅的消息，RESP2中是数组
+type PushReply struct {
+	Args []resp.Reply
+}
+
+func MakePushReply(args []resp.Reply) *PushReply {
+	return &PushReply{Args: args}
+}
+
+func (r *PushReply) ToBytes() []byte {
+	return encodeAggregate('*', len(r.Args), r.Args, Resp2)
+}
+
+func (r *PushReply) ToResp3Bytes() []byte {
+	return encodeAggregate('>', len(r.Args), r.Args, Resp3)
+}
+
+// DoubleReply 浮点数回复，RESP2中是字符串
+type DoubleReply struct {
+	Value float64
+}
+
+func MakeDoubleReply(value float64) *DoubleReply {
+	return &DoubleReply{Value: value}
+}
+
+func (r *DoubleReply) ToBytes() []byte {
+	return MakeBulkReply([]byte(strconv.FormatFloat(r.Value, 'f', -1, 64))).ToBytes()
+}
+
+func (r *DoubleReply) ToResp3Bytes() []byte {
+	var value string
+	switch {
+	case math.IsInf(r.Value, 1):
+		value = "inf"
+	case math.IsInf(r.Value, -1):
+		value = "-inf"
+	case math.IsNaN(r.Value):
+		value = "nan"
+	default:
+		value = strconv.FormatFloat(r.Value, 'f', -1, 64)
+	}
+	return []byte("," + value + CRLF)
+}
+
+// BooleanReply 布尔回复，RESP2中是数字1或0
+type BooleanReply struct {
+	Value bool
+}
+
+func MakeBooleanReply(value bool) *BooleanReply {
+	return &BooleanReply{Value: value}
+}
+
+func (r *BooleanReply) ToBytes() []byte {
+	if r.Value {
+		return []byte(":1" + CRLF)
+	}
+	return []byte(":0" + CRLF)
+}
+
+func (r *BooleanReply) ToResp3Bytes() []byte {
+	if r.Value {
+		return []byte("#t" + CRLF)
+	}
+	return []byte("#f" + CRLF)
+}
+
+// NullReply 空值回复，RESP2中是空字符串回复
+type NullReply struct{}
+
+var nullBytes = []byte("_\r\n")
+
+func MakeNullReply() *NullReply {
+	return &NullReply{}
+}
+
+func (r *NullReply) ToBytes() []byte {
+	return nullBulkBytes
+}
+
+func (r *NullReply) ToResp3Bytes() []byte {
+	return nullBytes
+}
+
+// BigNumberReply 大数回复，RESP2中是字符串
+type BigNumberReply struct {
+	Value *big.Int
+}
+
+func MakeBigNumberReply(value *big.Int) *BigNumberReply {
+	return &BigNumberReply{Value: value}
+}
+
+func (r *BigNumberReply) ToBytes() []byte {
+	return MakeBulkReply([]byte(r.Value.String())).ToBytes()
+}
+
+func (r *BigNumberReply) ToResp3Bytes() []byte {
+	return []byte("(" + r.Value.String() + CRLF)
+}
+
+// VerbatimReply 带格式的文本回复，比如 txt、mkd，RESP2中是字符串
+type VerbatimReply struct {
+	// 三个字符的格式
+	Format string
+	Text   string
+}
+
+func MakeVerbatimReply(format string, text string) *VerbatimReply {
+	return &VerbatimReply{Format: format, Text: text}
+}
+
+func (r *VerbatimReply) ToBytes() []byte {
+	return MakeBulkReply([]byte(r.Text)).ToBytes()
+}
+
+func (r *VerbatimReply) ToResp3Bytes() []byte {
+	content := r.Format + ":" + r.Text
+	return []byte("=" + strconv.Itoa(len(content)) + CRLF + content + CRLF)
+}
+
+/*
+ * 已有的回复在RESP3下的编码
+ */
+
+func (n NullBulkReply) ToResp3Bytes() []byte {
+	return nullBytes
+}
+
+func (r *MultiBulkReply) ToResp3Bytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("*" + strconv.Itoa(len(r.Args)) + CRLF)
+	for _, arg := range r.Args {
+		if arg == nil {
+			buf.Write(nullBytes)
+		} else {
+			buf.WriteString("$" + strconv.Itoa(len(arg)) + CRLF + string(arg) + CRLF)
+		}
+	}
+	return buf.Bytes()
+}
+
+func (r *MultiRawReply) ToResp3Bytes() []byte {
+	return encodeAggregate('*', len(r.Replies), r.Replies, Resp3)
+}
+
+func (r *BulkReply) ToResp3Bytes() []byte {
+	if r.Arg == nil {
+		return nullBytes
+	}
+	return r.ToBytes()
+}
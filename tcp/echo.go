@@ -73,6 +73,11 @@ func (handler *EchoHandler) Handle(ctx context.Context, conn net.Conn) {
 	}
 }
 
+// Done 回声服务器不会主动关闭
+func (handler *EchoHandler) Done() <-chan struct{} {
+	return nil
+}
+
 func (handler *EchoHandler) Close() error {
 	logger.Info("handler shutting down")
 	handler.closing.Set(true)
@@ -4,67 +4,141 @@ import (
 	"GoRedis/interface/tcp"
 	"GoRedis/lib/logger"
 	"context"
+	"crypto/tls"
+	"errors"
 	"net"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 )
 
 // Config 用于tcp连接的配置
 type Config struct {
+	// 明文监听的地址，为空表示不监听
 	Address string
+	// TLS监听的地址，为空表示不监听
+	TLSAddress string
+	// TLS配置，由 MakeTLSConfig 创建
+	TLSConfig *tls.Config
+	// Unix socket 的路径，为空表示不监听
+	UnixSocket string
+	// Unix socket 文件的权限，0表示使用默认权限
+	UnixSocketPerm os.FileMode
+	// TCP keepalive 的间隔，0表示不开启
+	KeepAlive time.Duration
+	// 收到 SIGHUP 时调用，比如重新加载配置，为空时 SIGHUP 和 SIGTERM 一样关闭服务器
+	OnHangup func()
 }
 
 // ListenAndServeWithSignal 该函数的主要功能是绑定端口并处理请求、监听是否有来自系统的关闭信号
 func ListenAndServeWithSignal(cfg *Config, handler tcp.Handler) error {
 	closeChan := make(chan struct{})
-	sigChan := make(chan os.Signal)
+	// signal.Notify 发送时不会阻塞，通道没有缓冲时信号到达时没有在等待就会丢失
+	sigChan := make(chan os.Signal, 1)
 	// 将系统信号转发给sigChan
 	// Notify函数让signal包将输入信号转发到c，如果没有列出要传递的信号，会将所有输入信号传递到c，否则只传递列出的输入信号
 	signal.Notify(sigChan, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT)
 	// 如果收到系统发送的关闭信号，就向channel中发送空结构体，下面的方法就会立刻关闭连接
 	// 如果未收到系统发送的关闭信号，协程将阻塞
 	go func() {
-		sig := <-sigChan
-		switch sig {
-		case syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT:
+		for sig := range sigChan {
+			if sig == syscall.SIGHUP && cfg.OnHangup != nil {
+				cfg.OnHangup()
+				continue
+			}
 			closeChan <- struct{}{}
+			return
 		}
 	}()
 
-	listener, err := net.Listen("tcp", cfg.Address)
-	if err != nil {
-		return err
+	// 明文和TLS可以同时监听
+	listeners := make([]net.Listener, 0, 2)
+	closeAll := func() {
+		for _, listener := range listeners {
+			_ = listener.Close()
+		}
+	}
+	if cfg.Address != "" {
+		listener, err := net.Listen("tcp", cfg.Address)
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, &keepAliveListener{Listener: listener, period: cfg.KeepAlive})
+		logger.Info("start listen " + cfg.Address)
+	}
+	if cfg.TLSAddress != "" {
+		listener, err := net.Listen("tcp", cfg.TLSAddress)
+		if err != nil {
+			closeAll()
+			return err
+		}
+		// 先设置 keepalive 再进行TLS握手
+		listener = &keepAliveListener{Listener: listener, period: cfg.KeepAlive}
+		listeners = append(listeners, tls.NewListener(listener, cfg.TLSConfig))
+		logger.Info("start listen tls " + cfg.TLSAddress)
+	}
+	if cfg.UnixSocket != "" {
+		listener, err := listenUnix(cfg.UnixSocket, cfg.UnixSocketPerm)
+		if err != nil {
+			closeAll()
+			return err
+		}
+		listeners = append(listeners, listener)
+		logger.Info("start listen unix socket " + cfg.UnixSocket)
+	}
+	if len(listeners) == 0 {
+		return errors.New("no listening address configured")
 	}
-	logger.Info("start listen")
-	ListenAndServe(listener, handler, closeChan)
+	ListenAndServe(listeners, handler, closeChan)
 	return nil
 }
 
-// ListenAndServe 处理客户端连接
-func ListenAndServe(listener net.Listener, handler tcp.Handler, closeChan <-chan struct{}) {
+// ListenAndServe 处理所有监听器上的客户端连接
+func ListenAndServe(listeners []net.Listener, handler tcp.Handler, closeChan <-chan struct{}) {
+	closeAll := func() {
+		for _, listener := range listeners {
+			_ = listener.Close()
+		}
+		_ = handler.Close()
+	}
 	go func() {
+		select {
 		// 收到系统的关闭信号，马上关闭连接
-		<-closeChan
-		logger.Info("shutting down")
-		_ = listener.Close()
-		_ = handler.Close()
-	}()
-	defer func() {
-		_ = listener.Close()
-		_ = handler.Close()
+		case <-closeChan:
+			logger.Info("shutting down")
+		// 执行了 SHUTDOWN 命令
+		case <-handler.Done():
+		}
+		closeAll()
 	}()
+	defer closeAll()
 	// 创建一个空的上下文
 	ctx := context.Background()
 	// 如果新连接出错，需要等待所有已经连接的客户端退出再退出
 	var waitDone sync.WaitGroup
+	// 每个监听器一个协程接收连接，所有监听器都关闭后才退出
+	var acceptDone sync.WaitGroup
+	for _, listener := range listeners {
+		acceptDone.Add(1)
+		go func(listener net.Listener) {
+			defer acceptDone.Done()
+			serve(ctx, listener, handler, &waitDone)
+		}(listener)
+	}
+	acceptDone.Wait()
+	waitDone.Wait()
+}
+
+// 接收一个监听器上的连接
+func serve(ctx context.Context, listener net.Listener, handler tcp.Handler, waitDone *sync.WaitGroup) {
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
 			break
 		}
-		logger.Info("accepted link")
+		logger.With("addr", conn.RemoteAddr().String()).Verbose("accepted link")
 		// 每处理一个客户端业务，就向等待队列+1
 		waitDone.Add(1)
 		go func() {
@@ -74,7 +148,51 @@ func ListenAndServe(listener net.Listener, handler tcp.Handler, closeChan <-chan
 			// 业务逻辑
 			handler.Handle(ctx, conn)
 		}()
+	}
+}
 
+// 给接收到的TCP连接设置 keepalive，及时发现已经断开的客户端
+type keepAliveListener struct {
+	net.Listener
+	period time.Duration
+}
+
+func (l *keepAliveListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
 	}
-	waitDone.Wait()
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		if l.period <= 0 {
+			_ = tcpConn.SetKeepAlive(false)
+		} else {
+			_ = tcpConn.SetKeepAlive(true)
+			_ = tcpConn.SetKeepAlivePeriod(l.period)
+		}
+	}
+	return conn, nil
+}
+
+// 监听 Unix socket，启动前删除上次没有清理的socket文件
+// 监听器关闭时会自动删除socket文件
+func listenUnix(path string, perm os.FileMode) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, errors.New(path + " exists and is not a socket")
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if perm != 0 {
+		if err := os.Chmod(path, perm); err != nil {
+			_ = listener.Close()
+			return nil, err
+		}
+	}
+	return listener, nil
 }
@@ -0,0 +1,52 @@
+package tcp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"strings"
+)
+
+// MakeTLSConfig 根据证书文件创建TLS配置
+// authClients 为 yes 时要求客户端提供证书，optional 时客户端可以不提供证书，no 时不验证客户端
+// 只用于服务端监听，目前没有集群模式，节点之间的连接还不支持TLS
+func MakeTLSConfig(certFile, keyFile, caCertFile, authClients string) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("tls-cert-file and tls-key-file are required")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	// 验证客户端证书使用的CA
+	if caCertFile != "" {
+		pem, err := os.ReadFile(caCertFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no valid certificate in " + caCertFile)
+		}
+		tlsConfig.ClientCAs = pool
+	}
+	switch strings.ToLower(authClients) {
+	case "", "no":
+		tlsConfig.ClientAuth = tls.NoClientCert
+	case "yes":
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	case "optional":
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return nil, errors.New("invalid tls-auth-clients: " + authClients)
+	}
+	if tlsConfig.ClientAuth != tls.NoClientCert && tlsConfig.ClientCAs == nil {
+		return nil, errors.New("tls-ca-cert-file is required to authenticate clients")
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,279 @@
+package tcp
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 测试用的CA，用来签发服务端和客户端证书
+type testCA struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	pool    *x509.CertPool
+	pemFile string
+}
+
+var serialNumber int64
+
+func nextSerial() *big.Int {
+	serialNumber++
+	return big.NewInt(serialNumber)
+}
+
+func newTestCA(t *testing.T, dir string, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          nextSerial(),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	pemFile := filepath.Join(dir, name+".crt")
+	writePEM(t, pemFile, "CERTIFICATE", der)
+	return &testCA{cert: cert, key: key, pool: pool, pemFile: pemFile}
+}
+
+// 签发证书，返回证书和私钥的文件路径
+func (ca *testCA) issue(t *testing.T, dir string, name string, usage x509.ExtKeyUsage) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: nextSerial(),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDer)
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, path string, typ string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 同时监听明文和TLS端口的回声服务器，返回两个地址
+func startServer(t *testing.T, tlsConfig *tls.Config) (string, string) {
+	t.Helper()
+	plain, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secure, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		_ = plain.Close()
+		t.Fatal(err)
+	}
+	listeners := []net.Listener{plain, tls.NewListener(secure, tlsConfig)}
+	closeChan := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		ListenAndServe(listeners, MakeHandler(), closeChan)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		close(closeChan)
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Error("server did not stop")
+		}
+	})
+	return plain.Addr().String(), secure.Addr().String()
+}
+
+// 发送一行并读取回声
+func echo(conn net.Conn, timeout time.Duration) error {
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write([]byte("ping\n")); err != nil {
+		return err
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if line != "ping\n" {
+		return &net.AddrError{Err: "unexpected echo " + line}
+	}
+	return nil
+}
+
+func dialTLS(addr string, config *tls.Config) error {
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", addr, config)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// TLS 1.3 中服务端在客户端完成握手之后才验证客户端证书，需要读取一次才能发现被拒绝
+	return echo(conn, 5*time.Second)
+}
+
+func TestPlainAndTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	certFile, keyFile := ca.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+	tlsConfig, err := MakeTLSConfig(certFile, keyFile, "", "no")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plainAddr, tlsAddr := startServer(t, tlsConfig)
+
+	conn, err := net.DialTimeout("tcp", plainAddr, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := echo(conn, 5*time.Second); err != nil {
+		t.Errorf("plaintext echo: %v", err)
+	}
+	_ = conn.Close()
+
+	if err := dialTLS(tlsAddr, &tls.Config{RootCAs: ca.pool, ServerName: "localhost"}); err != nil {
+		t.Errorf("tls echo: %v", err)
+	}
+	// 不信任服务端证书的客户端握手失败
+	if err := dialTLS(tlsAddr, &tls.Config{ServerName: "localhost"}); err == nil {
+		t.Error("expected tls handshake to fail without the CA")
+	}
+	// TLS端口不接受明文协议，握手失败后回声服务器不会关闭连接，读取超时即可
+	conn, err = net.DialTimeout("tcp", tlsAddr, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := echo(conn, 500*time.Millisecond); err == nil {
+		t.Error("expected plaintext on the tls port to fail")
+	}
+	_ = conn.Close()
+}
+
+func TestTLSAuthClients(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	other := newTestCA(t, dir, "other-ca")
+	serverCert, serverKey := ca.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+	clientCertFile, clientKeyFile := ca.issue(t, dir, "client", x509.ExtKeyUsageClientAuth)
+	untrustedCertFile, untrustedKeyFile := other.issue(t, dir, "untrusted", x509.ExtKeyUsageClientAuth)
+	clientCert, err := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	untrustedCert, err := tls.LoadX509KeyPair(untrustedCertFile, untrustedKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const (
+		noCert = iota
+		validCert
+		untrusted
+	)
+	tests := []struct {
+		authClients string
+		client      int
+		ok          bool
+	}{
+		{"no", noCert, true},
+		{"no", validCert, true},
+		{"yes", noCert, false},
+		{"yes", validCert, true},
+		{"yes", untrusted, false},
+		{"optional", noCert, true},
+		{"optional", validCert, true},
+		{"optional", untrusted, false},
+	}
+	for _, tt := range tests {
+		tlsConfig, err := MakeTLSConfig(serverCert, serverKey, ca.pemFile, tt.authClients)
+		if err != nil {
+			t.Fatalf("tls-auth-clients %s: %v", tt.authClients, err)
+		}
+		_, tlsAddr := startServer(t, tlsConfig)
+		clientConfig := &tls.Config{RootCAs: ca.pool, ServerName: "localhost"}
+		switch tt.client {
+		case validCert:
+			clientConfig.Certificates = []tls.Certificate{clientCert}
+		case untrusted:
+			// 证书不是服务端信任的CA签发的，客户端默认不会发送，强制发送
+			clientConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return &untrustedCert, nil
+			}
+		}
+		err = dialTLS(tlsAddr, clientConfig)
+		if tt.ok && err != nil {
+			t.Errorf("tls-auth-clients %s, client %d: unexpected error %v", tt.authClients, tt.client, err)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("tls-auth-clients %s, client %d: expected connection to be rejected", tt.authClients, tt.client)
+		}
+	}
+}
+
+func TestMakeTLSConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	certFile, keyFile := ca.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+
+	if _, err := MakeTLSConfig("", keyFile, "", "no"); err == nil {
+		t.Error("expected error without tls-cert-file")
+	}
+	if _, err := MakeTLSConfig(certFile, keyFile, "", "yes"); err == nil {
+		t.Error("expected error for tls-auth-clients yes without tls-ca-cert-file")
+	}
+	if _, err := MakeTLSConfig(certFile, keyFile, "", "optional"); err == nil {
+		t.Error("expected error for tls-auth-clients optional without tls-ca-cert-file")
+	}
+	if _, err := MakeTLSConfig(certFile, keyFile, ca.pemFile, "maybe"); err == nil {
+		t.Error("expected error for invalid tls-auth-clients")
+	}
+	if _, err := MakeTLSConfig(certFile, keyFile, certFile+".missing", "no"); err == nil {
+		t.Error("expected error for missing tls-ca-cert-file")
+	}
+}